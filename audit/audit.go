@@ -0,0 +1,177 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"gssh/config"
+	"os"
+	"os/user"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry is an action performed by gssh, one JSON line of the audit log.
+type Entry struct {
+	Time time.Time `json:"time"`
+	// User and Host are the local user running gssh and its machine.
+	User           string            `json:"user"`
+	Host           string            `json:"host"`
+	Action         string            `json:"action"`
+	Configuration  string            `json:"configuration,omitempty"`
+	Account        string            `json:"account,omitempty"`
+	ServiceAccount string            `json:"service_account,omitempty"`
+	Project        string            `json:"project,omitempty"`
+	Zone           string            `json:"zone,omitempty"`
+	Instance       string            `json:"instance,omitempty"`
+	Details        map[string]string `json:"details,omitempty"`
+	Error          string            `json:"error,omitempty"`
+}
+
+const (
+	defaultMaxSize  = 10
+	defaultMaxFiles = 5
+)
+
+// mu serializes the writes of this process, and the lock file those of the
+// other gssh processes, such as proxies, which would race during rotation.
+var mu sync.Mutex
+
+// Path is the current audit log. Rotated logs are numbered after it.
+func Path() string {
+	home, _ := os.UserHomeDir()
+	file := config.Config.Audit.File
+	if file == "" {
+		return path.Join(home, ".gssh", "audit.log")
+	}
+	if rest, ok := strings.CutPrefix(file, "~/"); ok {
+		return path.Join(home, rest)
+	}
+	return file
+}
+
+func maxSize() int64 {
+	size := config.Config.Audit.MaxSizeMB
+	if size <= 0 {
+		size = defaultMaxSize
+	}
+	return int64(size) << 20
+}
+
+func maxFiles() int {
+	if config.Config.Audit.MaxFiles <= 0 {
+		return defaultMaxFiles
+	}
+	return config.Config.Audit.MaxFiles
+}
+
+func rotated(n int) string {
+	return fmt.Sprintf("%v.%d", Path(), n)
+}
+
+// rotate shifts the logs once the current one is full, dropping the oldest.
+func rotate() error {
+	s, err := os.Stat(Path())
+	if err != nil || s.Size() < maxSize() {
+		return nil
+	}
+	_ = os.Remove(rotated(maxFiles()))
+	for n := maxFiles() - 1; n >= 1; n-- {
+		_ = os.Rename(rotated(n), rotated(n+1))
+	}
+	return os.Rename(Path(), rotated(1))
+}
+
+// lock takes the lock file of the audit log, until the returned function is
+// called.
+func lock() (func(), error) {
+	f, err := os.OpenFile(Path()+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return func() {
+		_ = unlockFile(f)
+		_ = f.Close()
+	}, nil
+}
+
+// Log appends e to the audit log, stamped with the time, user and host.
+func Log(e Entry) error {
+	e.Time = time.Now()
+	if u, err := user.Current(); err == nil {
+		e.User = u.Username
+	}
+	e.Host, _ = os.Hostname()
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if err := os.MkdirAll(path.Dir(Path()), 0700); err != nil {
+		return err
+	}
+	unlock, err := lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := rotate(); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(Path(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	_, err = fmt.Fprintf(f, "%s\n", line)
+	return err
+}
+
+// ErrorString is the message of err, or empty when nil.
+func ErrorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// Read returns the entries of every log, oldest first.
+func Read() ([]Entry, error) {
+	var entries []Entry
+	for n := maxFiles(); n >= 0; n-- {
+		file := Path()
+		if n > 0 {
+			file = rotated(n)
+		}
+		f, err := os.Open(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var e Entry
+			if err := json.Unmarshal(scanner.Bytes(), &e); err == nil {
+				entries = append(entries, e)
+			}
+		}
+		_ = f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
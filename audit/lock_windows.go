@@ -0,0 +1,17 @@
+package audit
+
+import (
+	"golang.org/x/sys/windows"
+	"os"
+)
+
+// The whole file is locked, as far as LockFileEx ranges go.
+const lockRange = ^uint32(0)
+
+func lockFile(f *os.File) error {
+	return windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK, 0, lockRange, lockRange, &windows.Overlapped{})
+}
+
+func unlockFile(f *os.File) error {
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, lockRange, lockRange, &windows.Overlapped{})
+}
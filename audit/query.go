@@ -0,0 +1,81 @@
+package audit
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Query selects entries of the audit log. Empty fields match every entry,
+// and Action also matches the actions it prefixes, as "ssh" does "ssh.end".
+type Query struct {
+	Since         time.Time
+	Action        string
+	User          string
+	Configuration string
+	Instance      string
+}
+
+func (q Query) Matches(e Entry) bool {
+	switch {
+	case e.Time.Before(q.Since):
+		return false
+	case q.Action != "" && e.Action != q.Action && !strings.HasPrefix(e.Action, q.Action+"."):
+		return false
+	case q.User != "" && e.User != q.User:
+		return false
+	case q.Configuration != "" && e.Configuration != q.Configuration:
+		return false
+	case q.Instance != "" && e.Instance != q.Instance:
+		return false
+	}
+	return true
+}
+
+// ParseSince reads either a duration back from now, such as 24h, or a date.
+func ParseSince(s string) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04", time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is neither a duration such as 24h nor a date such as 2006-01-02", s)
+}
+
+// Print writes the entries as a table.
+func Print(w io.Writer, entries []Entry) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "TIME\tUSER\tACTION\tCONFIGURATION\tACCOUNT\tINSTANCE\tDETAILS")
+	for _, e := range entries {
+		identity := e.Account
+		if e.ServiceAccount != "" {
+			identity += " as " + e.ServiceAccount
+		}
+		details := make([]string, 0, len(e.Details)+1)
+		for k, v := range e.Details {
+			details = append(details, k+"="+v)
+		}
+		sort.Strings(details)
+		if e.Error != "" {
+			// Keep one line per entry.
+			details = append(details, fmt.Sprintf("error=%q", e.Error))
+		}
+		_, _ = fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			e.Time.Local().Format(time.DateTime), orDash(e.User), e.Action,
+			orDash(e.Configuration), orDash(identity), orDash(e.Instance), strings.Join(details, " "))
+	}
+	return tw.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
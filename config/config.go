@@ -9,15 +9,82 @@ import (
 
 type SSHConfig struct {
 	UserName string `toml:"user_name"`
+	// ConfigFile is where `gssh ssh-config` writes the OpenSSH Host entries.
+	ConfigFile string `toml:"config_file"`
+	// Client is "gcloud" to run gcloud compute ssh, or "native" for the
+	// built-in client.
+	Client string `toml:"client"`
+	// KeyFile is the private key of the native client.
+	KeyFile string `toml:"key_file"`
+	// OSLogin registers the key with OS Login and logs in as its POSIX user.
+	OSLogin      bool `toml:"os_login"`
+	ForwardAgent bool `toml:"forward_agent"`
+	// KeepaliveInterval is in seconds, 0 disables keepalives.
+	KeepaliveInterval int `toml:"keepalive_interval"`
+	// ReconnectAttempts is how many times a dropped session is reconnected,
+	// 0 disables reconnecting.
+	ReconnectAttempts int `toml:"reconnect_attempts"`
+	// Record saves sessions in asciicast format to ~/.gssh/recordings.
+	Record bool `toml:"record"`
 }
 
 type InstancesConfig struct {
 	Exclusions []string `toml:"exclusions"`
+	// View is the initial layout of the instances panel, "list" or "table".
+	View string `toml:"view"`
+	// Columns are the columns of the table view, in order.
+	Columns []string `toml:"columns"`
+	// SortBy is the column the table view is sorted by, prefixed with "-"
+	// for descending order.
+	SortBy string `toml:"sort_by"`
+	// GroupBy is the initial grouping of the instances: "zone", "region",
+	// "instance_group" or "label:<key>".
+	GroupBy string `toml:"group_by"`
+	// GroupLabels are the label keys offered when cycling through groupings.
+	GroupLabels []string `toml:"group_labels"`
+}
+
+type ThemeConfig struct {
+	Name   string            `toml:"name"`
+	Colors map[string]string `toml:"colors"`
+}
+
+type LayoutConfig struct {
+	// Preset is the arrangement of the panels, see views.Layouts.
+	Preset string `toml:"preset"`
+}
+
+type AuditConfig struct {
+	// File is the audit log, ~/.gssh/audit.log by default.
+	File string `toml:"file"`
+	// MaxSizeMB is the size at which the log is rotated, and MaxFiles how
+	// many rotated logs are kept.
+	MaxSizeMB int `toml:"max_size_mb"`
+	MaxFiles  int `toml:"max_files"`
+}
+
+// ProtectedConfig marks instances that need a typed confirmation before
+// connecting to them.
+type ProtectedConfig struct {
+	Configurations []string `toml:"configurations"`
+	Projects       []string `toml:"projects"`
+	// Labels are selectors, either "key=value" or "key" for any value.
+	Labels []string `toml:"labels"`
 }
 
 type Configuration struct {
 	SSH       SSHConfig       `toml:"ssh"`
 	Instances InstancesConfig `toml:"instances"`
+	// Impersonation maps a gcloud configuration name to the service account
+	// to impersonate when listing and connecting to its instances.
+	Impersonation map[string]string `toml:"impersonation"`
+	// Keys overrides the default key bindings, by action name.
+	Keys   map[string][]string `toml:"keys"`
+	Theme  ThemeConfig         `toml:"theme"`
+	Layout LayoutConfig        `toml:"layout"`
+	Audit  AuditConfig         `toml:"audit"`
+	// Protected marks production instances.
+	Protected ProtectedConfig `toml:"protected"`
 }
 
 var Config Configuration
@@ -25,9 +92,61 @@ var Config Configuration
 var defaultConfigStr = `
 [ssh]
 user_name = "conductor"
+# Written by "gssh ssh-config", to Include from ~/.ssh/config.
+# config_file = "~/.gssh/ssh_config"
+# "gcloud" runs gcloud compute ssh, "native" uses the built-in client with
+# the key gcloud generates.
+client = "gcloud"
+# key_file = "~/.ssh/google_compute_engine"
+# os_login = false
+# forward_agent = false
+# keepalive_interval = 30
+# Reconnect dropped sessions, with an increasing delay between attempts.
+reconnect_attempts = 3
+# Record sessions to ~/.gssh/recordings, to play them back from the history.
+record = false
 
 [instances]
 exclusions = ["gke-"]
+view = "list"
+# Any of name, zone, status, machine_type, internal_ip, external_ip, labels, age.
+columns = ["name", "zone", "status", "machine_type", "internal_ip", "external_ip", "age"]
+sort_by = "name"
+# One of zone, region, instance_group or label:<key>. Leave empty not to group.
+group_by = ""
+group_labels = []
+
+[impersonation]
+# my-prod-configuration = "deployer@my-prod-project.iam.gserviceaccount.com"
+
+[keys]
+# quit = ["q", "ctrl+c"]
+# reload = ["r"]
+# clear_history = ["c"]
+
+[theme]
+# One of "dark", "light", "high-contrast" or "no-color".
+name = "dark"
+
+[theme.colors]
+# accent = "62"
+# highlight = "#ee6ff8"
+
+[layout]
+# One of "default", "history-right", "no-configurations" or "compact".
+preset = "default"
+
+[audit]
+# Every action is appended to the audit log, see "gssh audit".
+# file = "~/.gssh/audit.log"
+max_size_mb = 10
+max_files = 5
+
+[protected]
+# Connecting to these instances asks to type their name and for a reason.
+# configurations = ["my-prod-configuration"]
+# projects = ["my-prod-project"]
+# labels = ["env=prod"]
 `
 
 func init() {
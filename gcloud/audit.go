@@ -0,0 +1,95 @@
+package gcloud
+
+import (
+	"bufio"
+	"fmt"
+	"gssh/audit"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+)
+
+// configDir is where gcloud keeps its configurations.
+func configDir() string {
+	if dir := os.Getenv("CLOUDSDK_CONFIG"); dir != "" {
+		return dir
+	}
+	if runtime.GOOS == "windows" {
+		return path.Join(os.Getenv("APPDATA"), "gcloud")
+	}
+	home, _ := os.UserHomeDir()
+	return path.Join(home, ".config", "gcloud")
+}
+
+// configurationAccount reads the account of a configuration from its
+// properties file, faster than asking gcloud before every action.
+func configurationAccount(name string) string {
+	return configurationProperty(name, "core", "account")
+}
+
+// configurationProperty reads a property of a configuration, overridden by
+// its CLOUDSDK_ environment variable as in gcloud.
+func configurationProperty(name string, section string, property string) string {
+	if value := os.Getenv(strings.ToUpper("CLOUDSDK_" + section + "_" + property)); value != "" {
+		return value
+	}
+	f, err := os.Open(path.Join(configDir(), "configurations", "config_"+name))
+	if err != nil {
+		return ""
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var current string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			current = strings.Trim(line, "[]")
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if ok && section == current && strings.TrimSpace(key) == property {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// AuditFailed, when set, is told when the audit log cannot be written.
+// Failures are printed to stderr otherwise.
+var AuditFailed func(err error)
+
+// Audit appends e to the audit log, along with the account of its
+// configuration and the error of the action.
+func Audit(e audit.Entry, err error) error {
+	if e.Account == "" && e.Configuration != "" {
+		e.Account = configurationAccount(e.Configuration)
+	}
+	e.Error = audit.ErrorString(err)
+	if err := audit.Log(e); err != nil {
+		err = fmt.Errorf("writing the audit log: %w", err)
+		if AuditFailed != nil {
+			AuditFailed(err)
+		} else {
+			fmt.Fprintln(os.Stderr, "gssh:", err)
+		}
+		return err
+	}
+	return nil
+}
+
+// AuditEntry is the audit log entry of an action on the instance.
+func (i *Instance) AuditEntry(action string, configName string, serviceAccount string, details map[string]string) audit.Entry {
+	return audit.Entry{
+		Action:         action,
+		Configuration:  configName,
+		ServiceAccount: serviceAccount,
+		Project:        i.ProjectId(),
+		Zone:           i.Zone,
+		Instance:       i.Name,
+		Details:        details,
+	}
+}
@@ -0,0 +1,21 @@
+package gcloud
+
+import (
+	"os/exec"
+)
+
+// LoginCommand returns the interactive command refreshing the user
+// credentials of a configuration.
+func LoginCommand(c *Configuration) *exec.Cmd {
+	args := []string{"auth", "login", "--configuration", c.Name}
+	if c.Account != "" {
+		args = append(args, c.Account)
+	}
+	return exec.Command("gcloud", args...)
+}
+
+// ApplicationDefaultLoginCommand returns the interactive command refreshing
+// the application default credentials.
+func ApplicationDefaultLoginCommand(c *Configuration) *exec.Cmd {
+	return exec.Command("gcloud", "auth", "application-default", "login", "--configuration", c.Name)
+}
@@ -3,49 +3,146 @@ package gcloud
 import (
 	"encoding/json"
 	"fmt"
-	"os/exec"
+	"gssh/audit"
+	"gssh/config"
+	"strings"
 )
 
 type Configuration struct {
+	Name        string `json:"name"`
+	Account     string `json:"account"`
+	Project     string `json:"project"`
+	Region      string `json:"region"`
+	Zone        string `json:"zone"`
+	Impersonate string `json:"impersonate_service_account"`
+	Active      bool   `json:"is_active"`
+	Activating  bool   `json:"-"`
+	AuthExpired bool   `json:"-"`
+	// ImpersonateOverride is the service account picked interactively for
+	// this session, empty for the account itself. It takes precedence over
+	// every other setting when set.
+	ImpersonateOverride *string `json:"-"`
+}
+
+type rawConfiguration struct {
 	Name       string `json:"name"`
-	Account    string `json:"account"`
-	Project    string `json:"project"`
-	Active     bool   `json:"is_active"`
-	Activating bool   `json:"-"`
+	IsActive   bool   `json:"is_active"`
+	Properties struct {
+		Core struct {
+			Account string `json:"account"`
+			Project string `json:"project"`
+		} `json:"core"`
+		Compute struct {
+			Region string `json:"region"`
+			Zone   string `json:"zone"`
+		} `json:"compute"`
+		Auth struct {
+			ImpersonateServiceAccount string `json:"impersonate_service_account"`
+		} `json:"auth"`
+	} `json:"properties"`
+}
+
+// ServiceAccount returns the service account to impersonate, in order of
+// precedence: the interactive choice, the gssh config.toml and the gcloud
+// auth/impersonate_service_account property.
+func (c *Configuration) ServiceAccount() string {
+	if c.ImpersonateOverride != nil {
+		return *c.ImpersonateOverride
+	}
+	if sa := config.Config.Impersonation[c.Name]; sa != "" {
+		return sa
+	}
+	return c.Impersonate
+}
+
+// Identity returns the effective identity used for gcloud calls.
+func (c *Configuration) Identity() string {
+	if sa := c.ServiceAccount(); sa != "" {
+		return sa
+	}
+	return c.Account
+}
+
+// Incomplete reports whether the configuration lacks the core properties
+// needed to list and SSH into instances.
+func (c *Configuration) Incomplete() bool {
+	return c.Account == "" || c.Project == ""
+}
+
+// Warning describes what is missing from an incomplete configuration.
+func (c *Configuration) Warning() string {
+	var missing []string
+	if c.Account == "" {
+		missing = append(missing, "account")
+	}
+	if c.Project == "" {
+		missing = append(missing, "project")
+	}
+	if len(missing) == 0 {
+		return ""
+	}
+	return "no " + strings.Join(missing, "/")
 }
 
 func (c *Configuration) Title() string {
+	title := c.Name
 	if c.Active {
-		return fmt.Sprintf("%v ✅", c.Name)
+		title = fmt.Sprintf("%v ✅", title)
+	} else if c.Activating {
+		title = fmt.Sprintf("%v 🔄", title)
+	}
+	if c.Incomplete() {
+		title = fmt.Sprintf("%v ⚠️ %v", title, c.Warning())
+	}
+	if c.AuthExpired {
+		title = fmt.Sprintf("%v 🔒 auth expired", title)
 	}
-	if c.Activating {
-		return fmt.Sprintf("%v 🔄", c.Name)
+	if c.Protected() {
+		title = fmt.Sprintf("%v 🛡️ protected", title)
 	}
-	return c.Name
+	return title
 }
 func (c *Configuration) Description() string {
-	return fmt.Sprintf("Account: %s, Project: %s", c.Account, c.Project)
+	parts := []string{
+		fmt.Sprintf("Account: %s", orNone(c.Account)),
+		fmt.Sprintf("Project: %s", orNone(c.Project)),
+	}
+	if c.Zone != "" {
+		parts = append(parts, fmt.Sprintf("Zone: %s", c.Zone))
+	} else if c.Region != "" {
+		parts = append(parts, fmt.Sprintf("Region: %s", c.Region))
+	}
+	if sa := c.ServiceAccount(); sa != "" {
+		parts = append(parts, fmt.Sprintf("As: %s", sa))
+	}
+	return strings.Join(parts, ", ")
 }
 func (c *Configuration) FilterValue() string { return c.Name }
 
+func orNone(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
 func (c *Configuration) UnmarshalJSON(data []byte) error {
-	var raw map[string]interface{}
+	var raw rawConfiguration
 	if err := json.Unmarshal(data, &raw); err != nil {
 		return err
 	}
-	c.Name = raw["name"].(string)
-	c.Active = raw["is_active"].(bool)
-
-	properties := raw["properties"].(map[string]interface{})
-	core := properties["core"].(map[string]interface{})
-	c.Account = core["account"].(string)
-	c.Project = core["project"].(string)
+	c.Name = raw.Name
+	c.Active = raw.IsActive
+	c.Account = raw.Properties.Core.Account
+	c.Project = raw.Properties.Core.Project
+	c.Region = raw.Properties.Compute.Region
+	c.Zone = raw.Properties.Compute.Zone
+	c.Impersonate = raw.Properties.Auth.ImpersonateServiceAccount
 	return nil
 }
 
 func ListConfigurations() ([]*Configuration, error) {
-	cmd := exec.Command("gcloud", "config", "configurations", "list", "--format=json")
-	output, err := cmd.Output()
+	output, err := run("config", "configurations", "list", "--format=json")
 	if err != nil {
 		fmt.Println("Error fetching configurations:", err)
 		return nil, err
@@ -59,7 +156,82 @@ func ListConfigurations() ([]*Configuration, error) {
 }
 
 func ActivateConfiguration(name string) error {
-	cmd := exec.Command("gcloud", "config", "configurations", "activate", name)
-	_, err := cmd.Output()
+	_, err := run("config", "configurations", "activate", name)
+	_ = Audit(audit.Entry{Action: "configuration.activate", Configuration: name}, err)
+	return err
+}
+
+type ConfigurationProperties struct {
+	Account string
+	Project string
+	Region  string
+	Zone    string
+}
+
+func (p ConfigurationProperties) details() map[string]string {
+	details := map[string]string{}
+	for property, value := range map[string]string{
+		"account": p.Account,
+		"project": p.Project,
+		"region":  p.Region,
+		"zone":    p.Zone,
+	} {
+		if value != "" {
+			details[property] = value
+		}
+	}
+	return details
+}
+
+func (c *Configuration) Properties() ConfigurationProperties {
+	return ConfigurationProperties{
+		Account: c.Account,
+		Project: c.Project,
+		Region:  c.Region,
+		Zone:    c.Zone,
+	}
+}
+
+func CreateConfiguration(name string, props ConfigurationProperties) error {
+	_, err := run("config", "configurations", "create", name, "--no-activate")
+	if err == nil {
+		err = SetConfigurationProperties(name, props)
+	}
+	_ = Audit(audit.Entry{Action: "configuration.create", Configuration: name, Details: props.details()}, err)
+	return err
+}
+
+func SetConfigurationProperties(name string, props ConfigurationProperties) error {
+	values := []struct {
+		property string
+		value    string
+	}{
+		{"core/account", props.Account},
+		{"core/project", props.Project},
+		{"compute/region", props.Region},
+		{"compute/zone", props.Zone},
+	}
+	for _, v := range values {
+		if v.value == "" {
+			continue
+		}
+		if _, err := run("config", "set", v.property, v.value, "--configuration", name); err != nil {
+			return fmt.Errorf("setting %v: %w", v.property, err)
+		}
+	}
+	return nil
+}
+
+func RenameConfiguration(name string, newName string) error {
+	_, err := run("config", "configurations", "rename", name, "--new-name", newName)
+	_ = Audit(audit.Entry{Action: "configuration.rename", Configuration: name, Details: map[string]string{"new_name": newName}}, err)
+	return err
+}
+
+func DeleteConfiguration(name string) error {
+	// The account is read before the configuration is gone.
+	account := configurationAccount(name)
+	_, err := run("config", "configurations", "delete", name, "--quiet")
+	_ = Audit(audit.Entry{Action: "configuration.delete", Configuration: name, Account: account}, err)
 	return err
 }
@@ -0,0 +1,123 @@
+package gcloud
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Error is returned when a gcloud command fails. It keeps the command's
+// stderr, which carries the actual reason for the failure.
+type Error struct {
+	Args   []string
+	Stderr string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	if e.Stderr == "" {
+		return e.Err.Error()
+	}
+	return e.Stderr
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Failed reports whether gcloud itself failed, rather than the program it
+// ran, such as ssh, exiting with an error status.
+func (e *Error) Failed() bool {
+	return strings.Contains(e.Stderr, "ERROR: (gcloud.")
+}
+
+var authErrorMarkers = []string{
+	"gcloud auth login",
+	"Reauthentication failed",
+	"problem refreshing your current auth tokens",
+	"invalid_grant",
+	"do not currently have an active account selected",
+	"Your current active account",
+}
+
+// IsAuthError reports whether err was caused by missing or expired gcloud
+// credentials.
+func IsAuthError(err error) bool {
+	var gerr *Error
+	if !errors.As(err, &gerr) {
+		return false
+	}
+	for _, marker := range authErrorMarkers {
+		if strings.Contains(gerr.Stderr, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// stderrTail is how much of the stderr of interactive commands is kept for
+// their errors.
+const stderrTail = 4096
+
+// tailBuffer keeps the last max bytes written to it.
+type tailBuffer struct {
+	max  int
+	data []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.data = append(b.data, p...)
+	if len(b.data) > b.max {
+		b.data = b.data[len(b.data)-b.max:]
+	}
+	return len(p), nil
+}
+
+// impersonateProperty overrides the auth/impersonate_service_account
+// property of the configuration.
+const impersonateProperty = "CLOUDSDK_AUTH_IMPERSONATE_SERVICE_ACCOUNT"
+
+// environ is the environment of a gcloud command impersonating
+// serviceAccount. Without one, the auth/impersonate_service_account property
+// is cleared, as gcloud would impersonate it anyway.
+func environ(serviceAccount string) []string {
+	if serviceAccount != "" {
+		return nil
+	}
+	return append(os.Environ(), impersonateProperty+"=")
+}
+
+// commandLine is the shell command line of gcloud with args, clearing the
+// impersonation of the configuration as environ does.
+func commandLine(configName string, serviceAccount string, args []string) string {
+	line := "gcloud " + strings.Join(args, " ")
+	if serviceAccount == "" && configurationProperty(configName, "auth", "impersonate_service_account") != "" {
+		return impersonateProperty + "= " + line
+	}
+	return line
+}
+
+func run(args ...string) ([]byte, error) {
+	return runEnv(nil, args...)
+}
+
+// runAs runs gcloud impersonating serviceAccount, or nobody when empty.
+func runAs(serviceAccount string, args ...string) ([]byte, error) {
+	return runEnv(environ(serviceAccount), args...)
+}
+
+func runEnv(env []string, args ...string) ([]byte, error) {
+	cmd := exec.Command("gcloud", args...)
+	cmd.Env = env
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, &Error{
+			Args:   args,
+			Stderr: strings.TrimSpace(stderr.String()),
+			Err:    err,
+		}
+	}
+	return output, nil
+}
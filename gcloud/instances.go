@@ -5,9 +5,13 @@ import (
 	"fmt"
 	"github.com/charmbracelet/bubbles/list"
 	"gssh/config"
+	"io"
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -21,15 +25,80 @@ var (
 )
 
 type Instance struct {
-	Name   string
-	Zone   string
-	Status InstanceStatus
+	Name        string
+	Zone        string
+	Project     string
+	Status      InstanceStatus
+	MachineType string            `json:",omitempty"`
+	InternalIP  string            `json:",omitempty"`
+	ExternalIP  string            `json:",omitempty"`
+	Labels      map[string]string `json:",omitempty"`
+	CreatedAt   time.Time
+	// InstanceGroup is the managed instance group that created the instance.
+	InstanceGroup string `json:",omitempty"`
+}
+
+type rawInstance struct {
+	Name              string            `json:"name"`
+	Zone              string            `json:"zone"`
+	Status            string            `json:"status"`
+	MachineType       string            `json:"machineType"`
+	Labels            map[string]string `json:"labels"`
+	CreationTimestamp time.Time         `json:"creationTimestamp"`
+	Metadata          struct {
+		Items []struct {
+			Key   string `json:"key"`
+			Value string `json:"value"`
+		} `json:"items"`
+	} `json:"metadata"`
+	NetworkInterfaces []struct {
+		NetworkIP     string `json:"networkIP"`
+		AccessConfigs []struct {
+			NatIP string `json:"natIP"`
+		} `json:"accessConfigs"`
+	} `json:"networkInterfaces"`
+}
+
+func (raw *rawInstance) instance(project string) *Instance {
+	inst := &Instance{
+		Name:        raw.Name,
+		Zone:        raw.Zone,
+		Project:     project,
+		Status:      InstanceStatus(raw.Status),
+		MachineType: path.Base(raw.MachineType),
+		Labels:      raw.Labels,
+		CreatedAt:   raw.CreationTimestamp,
+	}
+	for _, item := range raw.Metadata.Items {
+		// e.g. projects/123/zones/europe-west1-b/instanceGroupManagers/web
+		if item.Key == "created-by" && strings.Contains(item.Value, "/instanceGroupManagers/") {
+			inst.InstanceGroup = path.Base(item.Value)
+		}
+	}
+	if len(raw.NetworkInterfaces) > 0 {
+		nic := raw.NetworkInterfaces[0]
+		inst.InternalIP = nic.NetworkIP
+		if len(nic.AccessConfigs) > 0 {
+			inst.ExternalIP = nic.AccessConfigs[0].NatIP
+		}
+	}
+	return inst
 }
 
 var _ list.Item = &Instance{}
 
 func (i *Instance) Title() string       { return i.Name }
 func (i *Instance) Description() string { return path.Base(i.Zone) }
+
+// Region returns the region of the instance zone, e.g. europe-west1 for
+// europe-west1-b.
+func (i *Instance) Region() string {
+	zone := path.Base(i.Zone)
+	if idx := strings.LastIndex(zone, "-"); idx > 0 {
+		return zone[:idx]
+	}
+	return zone
+}
 func (i *Instance) FilterValue() string {
 	return i.Name
 }
@@ -51,12 +120,75 @@ func init() {
 	exclusions = validExclusions
 }
 
-func ListInstances(configName string, clearCache bool) ([]*Instance, *time.Time, error) {
+const cachePrefix = "instances_cache_"
+
+// CacheWritten, when set, is called whenever instances are cached.
+var CacheWritten func()
+
+func cacheFile(configName string, project string, serviceAccount string) string {
+	cacheKey := configName
+	if project != "" {
+		cacheKey = fmt.Sprintf("%v_%v", cacheKey, project)
+	}
+	if serviceAccount != "" {
+		cacheKey = fmt.Sprintf("%v_%v", cacheKey, serviceAccount)
+	}
+	return path.Join(cacheDir, fmt.Sprintf("%v%v.json", cachePrefix, cacheKey))
+}
+
+// CachedInstances are the instances of a cache file, with the configuration,
+// project and service account they were listed with.
+type CachedInstances struct {
+	ConfigName     string
+	Project        string
+	ServiceAccount string
+	Instances      []*Instance
+}
+
+// ListCachedInstances reads every instances cache, without calling gcloud.
+func ListCachedInstances() ([]CachedInstances, error) {
+	files, err := filepath.Glob(path.Join(cacheDir, cachePrefix+"*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var caches []CachedInstances
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var cached CachedInstances
+		if err := json.Unmarshal(data, &cached.Instances); err != nil {
+			continue
+		}
+		// Configuration names and project ids have no underscores, and
+		// service accounts are the only part with an @.
+		key := strings.TrimSuffix(strings.TrimPrefix(path.Base(file), cachePrefix), ".json")
+		parts := strings.Split(key, "_")
+		cached.ConfigName = parts[0]
+		for _, part := range parts[1:] {
+			if strings.Contains(part, "@") {
+				cached.ServiceAccount = part
+			} else {
+				cached.Project = part
+			}
+		}
+		caches = append(caches, cached)
+	}
+	return caches, nil
+}
+
+// ListInstances lists the instances visible through a configuration. When
+// project is empty, the configuration's core/project is used. When
+// serviceAccount is set, gcloud impersonates it.
+func ListInstances(configName string, project string, serviceAccount string, clearCache bool) ([]*Instance, *time.Time, error) {
 	var instances []*Instance
 	var lastUpdate = time.Now()
 	foundCache := false
 
-	cacheFile := path.Join(cacheDir, fmt.Sprintf("instances_cache_%v.json", configName))
+	cacheFile := cacheFile(configName, project, serviceAccount)
 	if !clearCache {
 		if cached, err := os.ReadFile(cacheFile); err == nil {
 			_ = json.Unmarshal(cached, &instances)
@@ -71,24 +203,26 @@ func ListInstances(configName string, clearCache bool) ([]*Instance, *time.Time,
 	}
 
 	if instances == nil || len(instances) == 0 {
-		cmd := exec.Command("gcloud", "compute", "instances", "list", "--format=json", "--configuration", configName)
-		output, err := cmd.Output()
+		args := []string{"compute", "instances", "list", "--format=json", "--configuration", configName}
+		if project != "" {
+			args = append(args, "--project", project)
+		}
+		if serviceAccount != "" {
+			args = append(args, "--impersonate-service-account", serviceAccount)
+		}
+		output, err := runAs(serviceAccount, args...)
 		if err != nil {
 			return nil, nil, err
 		}
 
-		var rawInstances []map[string]interface{}
+		var rawInstances []rawInstance
 		if err = json.Unmarshal(output, &rawInstances); err != nil {
 			return nil, nil, err
 		}
 
 		instances = make([]*Instance, len(rawInstances))
 		for i, raw := range rawInstances {
-			instances[i] = &Instance{
-				Name:   raw["name"].(string),
-				Zone:   raw["zone"].(string),
-				Status: InstanceStatus(raw["status"].(string)),
-			}
+			instances[i] = raw.instance(project)
 		}
 	}
 
@@ -109,23 +243,160 @@ func ListInstances(configName string, clearCache bool) ([]*Instance, *time.Time,
 
 	if !foundCache {
 		cacheData, _ := json.Marshal(filteredInstances)
-		if err := os.WriteFile(cacheFile, cacheData, 0644); err != nil {
+		if err := os.WriteFile(cacheFile, cacheData, 0644); err == nil && CacheWritten != nil {
+			CacheWritten()
 		}
 	}
 
 	return filteredInstances, &lastUpdate, nil
 }
 
-func (i *Instance) SSH(configName string) error {
+// flags locate the instance for the gcloud compute commands.
+func (i *Instance) flags(configName string, serviceAccount string) []string {
 	zone := strings.Split(i.Zone, "/")
-	zoneFlag := "--zone=" + zone[len(zone)-1]
-	cmd := exec.Command("gcloud", "compute", "ssh", "--configuration", configName, fmt.Sprintf("%s@%s", config.Config.SSH.UserName, i.Name), zoneFlag)
+	flags := []string{"--configuration", configName, "--zone=" + zone[len(zone)-1]}
+	if i.Project != "" {
+		flags = append(flags, "--project", i.Project)
+	}
+	if serviceAccount != "" {
+		flags = append(flags, "--impersonate-service-account", serviceAccount)
+	}
+	return flags
+}
+
+// args builds the arguments of a gcloud compute command logging into the
+// instance as userName, such as ssh or connect-to-serial-port.
+func (i *Instance) args(command string, userName string, configName string, serviceAccount string) []string {
+	if userName == "" {
+		userName = config.Config.SSH.UserName
+	}
+	args := []string{"compute", command, fmt.Sprintf("%s@%s", userName, i.Name)}
+	return append(args, i.flags(configName, serviceAccount)...)
+}
+
+// SSHCommand is the gcloud command line run by SSH.
+func (i *Instance) SSHCommand(configName string, serviceAccount string) string {
+	return commandLine(configName, serviceAccount, i.args("ssh", "", configName, serviceAccount))
+}
+
+// SSH logs into the instance as userName, or the configured user name when
+// empty, through an IAP tunnel when iap is set, printing the session to
+// stdout. The error keeps the end of the stderr of gcloud and ssh.
+func (i *Instance) SSH(configName string, serviceAccount string, userName string, iap bool, stdout io.Writer) error {
+	args := i.args("ssh", userName, configName, serviceAccount)
+	if iap {
+		args = append(args, "--tunnel-through-iap")
+	}
+	stderr := &tailBuffer{max: stderrTail}
+	cmd := exec.Command("gcloud", args...)
+	cmd.Env = environ(serviceAccount)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = io.MultiWriter(os.Stderr, stderr)
+
+	if err := cmd.Run(); err != nil {
+		return &Error{
+			Args:   args,
+			Stderr: strings.TrimSpace(string(stderr.data)),
+			Err:    err,
+		}
+	}
+	return nil
+}
+
+// SerialPort connects to the serial port of the instance in the foreground,
+// for when sshd is unreachable. The error keeps the end of the stderr of
+// gcloud.
+func (i *Instance) SerialPort(configName string, serviceAccount string) error {
+	args := i.args("connect-to-serial-port", "", configName, serviceAccount)
+	stderr := &tailBuffer{max: stderrTail}
+	cmd := exec.Command("gcloud", args...)
+	cmd.Env = environ(serviceAccount)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stderr = io.MultiWriter(os.Stderr, stderr)
 
 	if err := cmd.Run(); err != nil {
-		return err
+		return &Error{
+			Args:   args,
+			Stderr: strings.TrimSpace(string(stderr.data)),
+			Err:    err,
+		}
 	}
 	return nil
 }
+
+// IAPTunnelCommand is an ssh ProxyCommand reaching the instance through an
+// Identity-Aware Proxy tunnel, for instances without an external IP.
+func (i *Instance) IAPTunnelCommand(configName string, serviceAccount string) string {
+	return commandLine(configName, serviceAccount, i.iapTunnelArgs("%p", configName, serviceAccount))
+}
+
+func (i *Instance) iapTunnelArgs(port string, configName string, serviceAccount string) []string {
+	args := []string{"compute", "start-iap-tunnel", i.Name, port, "--listen-on-stdin"}
+	return append(args, i.flags(configName, serviceAccount)...)
+}
+
+// IAPTunnel connects stdin and stdout to port of the instance through an
+// Identity-Aware Proxy tunnel, until either side closes.
+func (i *Instance) IAPTunnel(port string, configName string, serviceAccount string) error {
+	cmd := i.IAPTunnelCmd(port, configName, serviceAccount)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// IAPTunnelCmd is the command tunnelling its stdin and stdout to port of the
+// instance, for callers handling the connection themselves.
+func (i *Instance) IAPTunnelCmd(port string, configName string, serviceAccount string) *exec.Cmd {
+	cmd := exec.Command("gcloud", i.iapTunnelArgs(port, configName, serviceAccount)...)
+	cmd.Env = environ(serviceAccount)
+	return cmd
+}
+
+// SerialPortOutput fetches the serial port output of the instance from byte
+// offset start, and returns it with the offset to continue from.
+func (i *Instance) SerialPortOutput(configName string, serviceAccount string, start int64) (string, int64, error) {
+	args := append([]string{"compute", "instances", "get-serial-port-output", i.Name}, i.flags(configName, serviceAccount)...)
+	args = append(args, "--start", strconv.FormatInt(start, 10), "--format=json")
+	output, err := runAs(serviceAccount, args...)
+	if err != nil {
+		return "", start, err
+	}
+
+	var result struct {
+		Contents string      `json:"contents"`
+		Next     json.Number `json:"next"`
+	}
+	if err := json.Unmarshal(output, &result); err != nil {
+		return "", start, err
+	}
+	next, err := result.Next.Int64()
+	if err != nil {
+		return "", start, err
+	}
+	return result.Contents, next, nil
+}
+
+// ProjectId is the project of the instance, read from its zone URL when it
+// was listed in the default project of its configuration.
+func (i *Instance) ProjectId() string {
+	if i.Project != "" {
+		return i.Project
+	}
+	// e.g. https://www.googleapis.com/compute/v1/projects/my-project/zones/europe-west1-b
+	parts := strings.Split(i.Zone, "/")
+	for idx, part := range parts[:max(len(parts)-1, 0)] {
+		if part == "projects" {
+			return parts[idx+1]
+		}
+	}
+	return ""
+}
+
+// ConsoleURL is the page of the instance in the Cloud Console.
+func (i *Instance) ConsoleURL() string {
+	return fmt.Sprintf("https://console.cloud.google.com/compute/instancesDetail/zones/%v/instances/%v?project=%v",
+		path.Base(i.Zone), i.Name, i.ProjectId())
+}
@@ -0,0 +1,49 @@
+package gcloud
+
+import (
+	"encoding/json"
+	"fmt"
+	"gssh/audit"
+)
+
+// AddOSLoginKey registers the public key in keyFile with the OS Login profile
+// of the configuration's account, or of serviceAccount when set, and returns
+// the POSIX user name to log in as.
+func AddOSLoginKey(configName string, serviceAccount string, keyFile string) (string, error) {
+	args := []string{"compute", "os-login", "ssh-keys", "add", "--key-file", keyFile, "--format=json", "--configuration", configName}
+	if serviceAccount != "" {
+		args = append(args, "--impersonate-service-account", serviceAccount)
+	}
+	output, err := runAs(serviceAccount, args...)
+	_ = Audit(audit.Entry{
+		Action:         "os_login.add_key",
+		Configuration:  configName,
+		ServiceAccount: serviceAccount,
+		Details:        map[string]string{"key_file": keyFile},
+	}, err)
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		LoginProfile struct {
+			PosixAccounts []struct {
+				Username string `json:"username"`
+				Primary  bool   `json:"primary"`
+			} `json:"posixAccounts"`
+		} `json:"loginProfile"`
+	}
+	if err := json.Unmarshal(output, &result); err != nil {
+		return "", err
+	}
+	accounts := result.LoginProfile.PosixAccounts
+	for _, account := range accounts {
+		if account.Primary {
+			return account.Username, nil
+		}
+	}
+	if len(accounts) == 0 {
+		return "", fmt.Errorf("no POSIX account in the OS Login profile")
+	}
+	return accounts[0].Username, nil
+}
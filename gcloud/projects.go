@@ -0,0 +1,30 @@
+package gcloud
+
+import (
+	"encoding/json"
+)
+
+type Project struct {
+	ProjectId  string `json:"projectId"`
+	Name       string `json:"name"`
+	ConfigName string `json:"-"`
+}
+
+func (p *Project) Title() string       { return "  ↳ " + p.ProjectId }
+func (p *Project) Description() string { return "    " + p.Name }
+func (p *Project) FilterValue() string { return p.ProjectId }
+
+func ListProjects(configName string) ([]*Project, error) {
+	output, err := run("projects", "list", "--format=json", "--sort-by=projectId", "--configuration", configName)
+	if err != nil {
+		return nil, err
+	}
+	var projects []*Project
+	if err := json.Unmarshal(output, &projects); err != nil {
+		return nil, err
+	}
+	for _, p := range projects {
+		p.ConfigName = configName
+	}
+	return projects, nil
+}
@@ -0,0 +1,41 @@
+package gcloud
+
+import (
+	"gssh/config"
+	"slices"
+	"strings"
+)
+
+func protectedConfiguration(name string) bool {
+	return slices.Contains(config.Config.Protected.Configurations, name)
+}
+
+func protectedProject(project string) bool {
+	return project != "" && slices.Contains(config.Config.Protected.Projects, project)
+}
+
+func protectedLabels(labels map[string]string) bool {
+	for _, selector := range config.Config.Protected.Labels {
+		key, value, hasValue := strings.Cut(selector, "=")
+		if v, ok := labels[strings.TrimSpace(key)]; ok && (!hasValue || v == strings.TrimSpace(value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Protected reports whether the configuration, or its default project, is
+// protected in config.toml.
+func (c *Configuration) Protected() bool {
+	return protectedConfiguration(c.Name) || protectedProject(c.Project)
+}
+
+func (p *Project) Protected() bool {
+	return protectedConfiguration(p.ConfigName) || protectedProject(p.ProjectId)
+}
+
+// Protected reports whether the instance is protected, by its configuration,
+// its project or its labels.
+func (i *Instance) Protected(configName string) bool {
+	return protectedConfiguration(configName) || protectedProject(i.ProjectId()) || protectedLabels(i.Labels)
+}
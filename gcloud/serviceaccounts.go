@@ -0,0 +1,36 @@
+package gcloud
+
+import (
+	"encoding/json"
+)
+
+type ServiceAccount struct {
+	Email       string `json:"email"`
+	DisplayName string `json:"displayName"`
+	Disabled    bool   `json:"disabled"`
+}
+
+func (s *ServiceAccount) Title() string { return s.Email }
+func (s *ServiceAccount) Description() string {
+	if s.Disabled {
+		return s.DisplayName + " (disabled)"
+	}
+	return s.DisplayName
+}
+func (s *ServiceAccount) FilterValue() string { return s.Email }
+
+func ListServiceAccounts(configName string, project string) ([]*ServiceAccount, error) {
+	args := []string{"iam", "service-accounts", "list", "--format=json", "--configuration", configName}
+	if project != "" {
+		args = append(args, "--project", project)
+	}
+	output, err := run(args...)
+	if err != nil {
+		return nil, err
+	}
+	var accounts []*ServiceAccount
+	if err := json.Unmarshal(output, &accounts); err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
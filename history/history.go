@@ -12,10 +12,15 @@ import (
 )
 
 type Connection struct {
-	Index      int
-	ConfigName string
-	Instance   *gcloud.Instance
-	Timestamp  time.Time
+	Index          int
+	ConfigName     string
+	ServiceAccount string `json:",omitempty"`
+	Instance       *gcloud.Instance
+	Timestamp      time.Time
+	// Recording is the asciicast file of the session, when recorded.
+	Recording string `json:",omitempty"`
+	// Reason is given when confirming a connection to a protected instance.
+	Reason string `json:",omitempty"`
 }
 
 func (c *Connection) Title() string {
@@ -27,7 +32,18 @@ func (c *Connection) Title() string {
 func (c *Connection) Description() string {
 	zoneSplit := strings.Split(c.Instance.Zone, "/")
 	zone := zoneSplit[len(zoneSplit)-1]
-	return fmt.Sprintf("%s - %s - %s", c.Timestamp.Format("02/01/2006 15:04:05"), c.ConfigName, zone)
+	target := c.ConfigName
+	if c.Instance.Project != "" {
+		target = fmt.Sprintf("%s/%s", c.ConfigName, c.Instance.Project)
+	}
+	description := fmt.Sprintf("%s - %s - %s", c.Timestamp.Format("02/01/2006 15:04:05"), target, zone)
+	if c.Recording != "" {
+		description += " - ⏺"
+	}
+	if c.Reason != "" {
+		description += fmt.Sprintf(" - 🛡️ %s", c.Reason)
+	}
+	return description
 }
 func (c *Connection) FilterValue() string {
 	return c.Instance.Name
@@ -68,13 +84,16 @@ func ListHistory() ([]*Connection, error) {
 	return history, err
 }
 
-func AddConnection(configName string, i *gcloud.Instance) {
+func AddConnection(configName string, serviceAccount string, i *gcloud.Instance, recording string, reason string) {
 	var conn *Connection
 	if conn == nil {
 		conn = &Connection{
-			ConfigName: configName,
-			Instance:   i,
-			Timestamp:  time.Now(),
+			ConfigName:     configName,
+			ServiceAccount: serviceAccount,
+			Instance:       i,
+			Timestamp:      time.Now(),
+			Recording:      recording,
+			Reason:         reason,
 		}
 		history = append(history, conn)
 	} else {
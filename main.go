@@ -1,34 +1,59 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	bl "github.com/winder/bubblelayout"
+	"golang.org/x/term"
+	"gssh/audit"
 	"gssh/config"
 	"gssh/gcloud"
 	"gssh/history"
+	"gssh/proxy"
+	"gssh/recording"
+	"gssh/sshclient"
+	"gssh/sshconfig"
+	"gssh/state"
 	"gssh/views"
+	"gssh/views/clipboard"
 	"gssh/views/configurations"
+	"gssh/views/confirm"
+	"gssh/views/dialog"
+	"gssh/views/help"
 	hist_view "gssh/views/history"
 	"gssh/views/instances"
+	"gssh/views/palette"
+	"gssh/views/player"
+	"gssh/views/serial"
 	"gssh/views/statusbar"
+	"io"
 	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"strings"
 	"time"
 )
 
 var _ tea.Model = &model{}
 
 type model struct {
-	layout                bl.BubbleLayout
-	configurationsPanelId bl.ID
-	instancesPanelId      bl.ID
-	historyPanelId        bl.ID
-	statusPanelId         bl.ID
-	configSize            bl.Size
-	instSize              bl.Size
-	historySize           bl.Size
-	statusSize            bl.Size
+	layout        bl.BubbleLayout
+	panelLayout   views.Layout
+	panelIds      map[views.ActivePanel]bl.ID
+	statusPanelId bl.ID
+	sizes         map[views.ActivePanel]bl.Size
+	statusSize    bl.Size
+	windowSize    tea.WindowSizeMsg
+	maximized     bool
 
 	activePanel views.ActivePanel
 
@@ -36,37 +61,186 @@ type model struct {
 	instances      tea.Model
 	history        tea.Model
 	statusBar      tea.Model
+	help           tea.Model
+	palette        tea.Model
+	serial         tea.Model
+	player         tea.Model
+	dialog         tea.Model
+	confirm        tea.Model
 
-	filtering bool
-	exited    bool
+	filtering      bool
+	editing        bool
+	showingHelp    bool
+	showingPalette bool
+	showingSerial  bool
+	showingPlayer  bool
+	showingDialog  bool
+	showingConfirm bool
+	exited         bool
 
-	selectedConfiguration     *gcloud.Configuration
-	selectedInstance          *gcloud.Instance
-	selectedHistoryConnection *history.Connection
+	lastClick click
+
+	selectedConfiguration *gcloud.Configuration
+	selectedProject       string
+	// connection is run once the UI exits. failed is the last one, when it
+	// could not connect, and confirming the one to a protected instance
+	// awaiting confirmation.
+	connection *connection
+	failed     *connection
+	confirming *connection
+	// restored are the commands of the panels restoring the saved state, run
+	// by the first Init.
+	restored tea.Cmd
+}
+
+// connection is an SSH session, or a serial port connection, requested from
+// the UI.
+type connection struct {
+	instance       *gcloud.Instance
+	configName     string
+	serviceAccount string
+	options        sshclient.Options
+	serialPort     bool
+	// reason is given when confirming a connection to a protected instance.
+	reason string
+}
+
+// audit logs an action on the instance of the connection.
+func (c *connection) audit(action string, details map[string]string, err error) error {
+	return gcloud.Audit(c.instance.AuditEntry(action, c.configName, c.serviceAccount, details), err)
+}
+
+// auditStart logs the start of the connection, which protected instances
+// are not connected to without.
+func (c *connection) auditStart(action string, details map[string]string) error {
+	err := c.audit(action, c.reasonDetails(details), nil)
+	if err != nil && c.instance.Protected(c.configName) {
+		return fmt.Errorf("not connecting to a protected instance without an audit log entry: %w", err)
+	}
+	return nil
+}
+
+// reasonDetails adds the confirmation of a protected instance to details.
+func (c *connection) reasonDetails(details map[string]string) map[string]string {
+	if !c.instance.Protected(c.configName) {
+		return details
+	}
+	if details == nil {
+		details = map[string]string{}
+	}
+	details["protected"] = "true"
+	if c.reason != "" {
+		details["reason"] = c.reason
+	}
+	return details
 }
 
 func initialModel() *model {
-	layout := bl.New()
-	configurationsPanelId := layout.Add("")
-	instancesPanelId := layout.Add("wrap")
-	historyPanelId := layout.Add("spanw 2 wrap")
-	statusPanelId := layout.Add("dock south 1!")
 	m := &model{
-		layout:                layout,
-		configurationsPanelId: configurationsPanelId,
-		instancesPanelId:      instancesPanelId,
-		historyPanelId:        historyPanelId,
-		statusPanelId:         statusPanelId,
-		activePanel:           views.Configurations,
-		configurations:        configurations.InitialModel(),
-		instances:             instances.InitialModel(),
-		history:               hist_view.InitialModel(),
-		statusBar:             statusbar.InitialModel(),
+		sizes:          map[views.ActivePanel]bl.Size{},
+		activePanel:    views.Configurations,
+		configurations: configurations.InitialModel(),
+		instances:      instances.InitialModel(),
+		history:        hist_view.InitialModel(),
+		statusBar:      statusbar.InitialModel(),
+		help:           help.InitialModel(),
+		palette:        palette.InitialModel(),
+		serial:         serial.InitialModel(),
+		player:         player.InitialModel(),
+		dialog:         dialog.InitialModel(),
+		confirm:        confirm.InitialModel(),
+	}
+	m.restore(state.Load())
+	if !views.PanelLayout.Contains(m.activePanel) {
+		m.activePanel = views.Instances
 	}
+	m.updateFocus()
+	m.setLayout()
 	return m
 }
 
+func (m *model) restore(s state.UI) {
+	if s.ActivePanel >= int(views.Configurations) && s.ActivePanel <= int(views.History) {
+		m.activePanel = views.ActivePanel(s.ActivePanel)
+	}
+	m.maximized = s.Maximized
+	var cmds []tea.Cmd
+	for _, panel := range []tea.Model{m.configurations, m.instances, m.history} {
+		_, cmd := panel.Update(state.RestoreMsg{UI: s})
+		cmds = append(cmds, cmd)
+	}
+	m.restored = tea.Batch(cmds...)
+}
+
+// saveState saves the state of the UI, restored when gssh starts again.
+func (m *model) saveState() {
+	s := state.UI{ActivePanel: int(m.activePanel), Maximized: m.maximized}
+	for _, panel := range []tea.Model{m.configurations, m.instances, m.history} {
+		if saver, ok := panel.(state.Saver); ok {
+			saver.SaveState(&s)
+		}
+	}
+	_ = state.Save(s)
+}
+
+// setLayout lays out the panels of the configured layout, or the focused
+// panel alone when maximized.
+func (m *model) setLayout() tea.Cmd {
+	m.panelLayout = views.PanelLayout
+	if m.maximized {
+		m.panelLayout = views.Maximized(m.activePanel)
+	}
+	m.layout = bl.New()
+	m.panelIds = map[views.ActivePanel]bl.ID{}
+	for _, row := range m.panelLayout {
+		for _, cell := range row {
+			m.panelIds[cell.Panel] = m.layout.Add(cell.Constraints)
+		}
+	}
+	m.statusPanelId = m.layout.Add("dock south 1!")
+	return m.resize()
+}
+
+func (m *model) resize() tea.Cmd {
+	if m.windowSize.Width == 0 {
+		return nil
+	}
+	layout, size := m.layout, m.windowSize
+	return func() tea.Msg {
+		return layout.Resize(size.Width, size.Height)
+	}
+}
+
+func (m *model) panel(panel views.ActivePanel) tea.Model {
+	switch panel {
+	case views.Instances:
+		return m.instances
+	case views.History:
+		return m.history
+	}
+	return m.configurations
+}
+
+// click remembers the last left click, to recognise double clicks.
+type click struct {
+	panel views.ActivePanel
+	y     int
+	at    time.Time
+}
+
+const doubleClickInterval = 400 * time.Millisecond
+
 type pollTickMsg struct{}
+type loginFinishedMsg struct{}
+
+// Messages dispatched by the command palette for the actions handled here
+// rather than by a panel.
+type quitMsg struct{}
+type reloadMsg struct{}
+type showHelpMsg struct{}
+type loginMsg struct{ applicationDefault bool }
+type focusPanelMsg struct{ panel views.ActivePanel }
+type maximizeMsg struct{}
 
 func (m *model) pollTick() tea.Cmd {
 	return tea.Tick(time.Second, func(t time.Time) tea.Msg {
@@ -75,11 +249,14 @@ func (m *model) pollTick() tea.Cmd {
 }
 
 func (m *model) Init() tea.Cmd {
+	restored := m.restored
+	m.restored = nil
 	return tea.Batch(
 		m.configurations.Init(),
 		m.instances.Init(),
 		m.history.Init(),
 		m.pollTick(),
+		restored,
 	)
 }
 
@@ -97,6 +274,126 @@ func (m *model) updateFocus() {
 		m.history.Update(hist_view.FocusMsg{})
 	}
 	m.statusBar.Update(statusbar.SetActivePanelMsg{ActivePanel: m.activePanel})
+	m.help.Update(help.SetActivePanelMsg{ActivePanel: m.activePanel})
+}
+
+func (m *model) focus(panel views.ActivePanel) tea.Cmd {
+	m.activePanel = panel
+	m.updateFocus()
+	if m.maximized {
+		return m.setLayout()
+	}
+	return nil
+}
+
+// cyclePanel focuses the next panel of the layout in the delta direction.
+func (m *model) cyclePanel(delta int) tea.Cmd {
+	panel := m.activePanel
+	for i := 0; i < 3; i++ {
+		panel = (panel + views.ActivePanel(delta) + 3) % 3
+		if views.PanelLayout.Contains(panel) {
+			break
+		}
+	}
+	return m.focus(panel)
+}
+
+func (m *model) refreshInstances(clearCache bool) tea.Cmd {
+	if m.selectedConfiguration == nil {
+		return nil
+	}
+	protected := m.selectedConfiguration.Protected()
+	if m.selectedProject != "" {
+		project := gcloud.Project{ProjectId: m.selectedProject, ConfigName: m.selectedConfiguration.Name}
+		protected = project.Protected()
+	}
+	_, cmd := m.instances.Update(instances.RefreshMsg{
+		ConfigName:     m.selectedConfiguration.Name,
+		Project:        m.selectedProject,
+		ServiceAccount: m.selectedConfiguration.ServiceAccount(),
+		ClearCache:     clearCache,
+		Protected:      protected,
+	})
+	return cmd
+}
+
+func (m *model) login(applicationDefault bool) tea.Cmd {
+	if m.selectedConfiguration == nil {
+		return nil
+	}
+	c := m.selectedConfiguration
+	cmd := gcloud.LoginCommand(c)
+	action := "auth.login"
+	if applicationDefault {
+		cmd = gcloud.ApplicationDefaultLoginCommand(c)
+		action = "auth.application_default_login"
+	}
+	return tea.ExecProcess(cmd, func(err error) tea.Msg {
+		_ = gcloud.Audit(audit.Entry{Action: action, Configuration: c.Name, Account: c.Account}, err)
+		return loginFinishedMsg{}
+	})
+}
+
+// fail shows the error of the connection c in the dialog, to retry it.
+func (m *model) fail(c *connection, title string, err error) {
+	m.failed = c
+	m.showingDialog = true
+	m.dialog.Update(dialog.OpenMsg{
+		Title:        title,
+		Err:          err,
+		Options:      c.options,
+		FixedOptions: c.serialPort,
+	})
+}
+
+// connect runs c once the UI exits, after a typed confirmation when its
+// instance is protected.
+func (m *model) connect(c *connection) tea.Cmd {
+	if !c.instance.Protected(c.configName) {
+		m.connection = c
+		return tea.Quit
+	}
+	action := fmt.Sprintf("SSH to [%v] -> %v", c.configName, c.instance.Name)
+	if c.serialPort {
+		action = fmt.Sprintf("connect to the serial port of [%v] -> %v", c.configName, c.instance.Name)
+	}
+	m.confirming = c
+	m.showingConfirm = true
+	_, cmd := m.confirm.Update(confirm.OpenMsg{Action: action, Name: c.instance.Name})
+	return cmd
+}
+
+func (m *model) commands() []palette.Command {
+	keys := views.Keys
+	hint := func(b key.Binding) string { return b.Help().Key }
+
+	commands := []palette.Command{
+		{Title: "Reload instances", Hint: hint(keys.Reload), Msg: reloadMsg{}},
+		{Title: "Clear history", Hint: hint(keys.ClearHistory), Msg: hist_view.ClearMsg{}},
+		{Title: "Log in", Hint: hint(keys.Login), Msg: loginMsg{}},
+		{Title: "Application-default log in", Hint: hint(keys.LoginADC), Msg: loginMsg{applicationDefault: true}},
+		{Title: "Maximize panel", Hint: hint(keys.Maximize), Msg: maximizeMsg{}},
+		{Title: "Help", Hint: hint(keys.Help), Msg: showHelpMsg{}},
+		{Title: "Quit", Hint: hint(keys.Quit), Msg: quitMsg{}},
+	}
+	for _, panel := range []struct {
+		title string
+		panel views.ActivePanel
+	}{
+		{"Focus configurations", views.Configurations},
+		{"Focus instances", views.Instances},
+		{"Focus history", views.History},
+	} {
+		if views.PanelLayout.Contains(panel.panel) {
+			commands = append(commands, palette.Command{Title: panel.title, Msg: focusPanelMsg{panel.panel}})
+		}
+	}
+	for _, panel := range []tea.Model{m.configurations, m.instances, m.history} {
+		if provider, ok := panel.(palette.Provider); ok {
+			commands = append(commands, provider.Commands()...)
+		}
+	}
+	return commands
 }
 
 func (m *model) speedDial(msg tea.Msg, index int) tea.Cmd {
@@ -110,10 +407,66 @@ func (m *model) speedDial(msg tea.Msg, index int) tea.Cmd {
 		}
 	}
 
-	m.activePanel = views.History
-	m.updateFocus()
+	var focusCmd tea.Cmd
+	if views.PanelLayout.Contains(views.History) {
+		focusCmd = m.focus(views.History)
+	}
 	_, speedDialCmd := m.history.Update(hist_view.SpeedDialMsg{ConnectionIndex: index})
-	return speedDialCmd
+	return tea.Batch(focusCmd, speedDialCmd)
+}
+
+// panelAt returns the panel rendered at x, y, and x, y relative to its top
+// left corner. ok is false below the panels, over the status bar.
+func (m *model) panelAt(x, y int) (panel views.ActivePanel, px, py int, ok bool) {
+	top := 0
+	for _, row := range m.panelLayout {
+		left, height := 0, 0
+		for _, cell := range row {
+			size := m.sizes[cell.Panel]
+			if x >= left && x < left+size.Width && y >= top && y < top+size.Height {
+				return cell.Panel, x - left, y - top, true
+			}
+			left += size.Width
+			height = max(height, size.Height)
+		}
+		top += height
+	}
+	return 0, x, y - top, false
+}
+
+func (m *model) mouse(msg tea.MouseMsg) tea.Cmd {
+	if m.showingPalette || m.showingHelp || m.editing || m.filtering {
+		return nil
+	}
+	panel, x, y, ok := m.panelAt(msg.X, msg.Y)
+
+	switch {
+	case msg.Action == tea.MouseActionPress && msg.Button == tea.MouseButtonLeft:
+		if !ok {
+			_, cmd := m.statusBar.Update(views.ClickMsg{X: x, Y: y})
+			return cmd
+		}
+
+		now := time.Now()
+		double := m.lastClick.panel == panel && m.lastClick.y == y && now.Sub(m.lastClick.at) < doubleClickInterval
+		m.lastClick = click{panel: panel, y: y, at: now}
+		if double {
+			// A third click starts over.
+			m.lastClick = click{}
+		}
+
+		var focusCmd tea.Cmd
+		if m.activePanel != panel {
+			focusCmd = m.focus(panel)
+		}
+		_, cmd := m.panel(panel).Update(views.ClickMsg{X: x, Y: y, Double: double})
+		return tea.Batch(focusCmd, cmd)
+
+	case ok && (msg.Button == tea.MouseButtonWheelUp || msg.Button == tea.MouseButtonWheelDown):
+		_, cmd := m.panel(panel).Update(views.WheelMsg{Down: msg.Button == tea.MouseButtonWheelDown})
+		return cmd
+	}
+	return nil
 }
 
 func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -123,12 +476,8 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case pollTickMsg:
 		if !m.filtering {
-			_, refreshInstancesCmd := m.instances.Update(instances.RefreshMsg{
-				ConfigName: m.selectedConfiguration.Name,
-				ClearCache: false,
-			})
+			cmds = append(cmds, m.refreshInstances(false))
 			_, refreshHistoryCmd := m.history.Update(hist_view.RefreshMsg{})
-			cmds = append(cmds, refreshInstancesCmd)
 			cmds = append(cmds, refreshHistoryCmd)
 			cmds = append(cmds, m.pollTick())
 		}
@@ -138,14 +487,127 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		cmds = append(cmds, refreshCmd)
 
 	case instances.ResultMsg:
-		m.instances.Update(msg)
+		_, cmd = m.instances.Update(msg)
 
 	case instances.ErrMsg:
-		m.instances.Update(msg)
+		_, cmd = m.instances.Update(msg)
+
+	case list.FilterMatchesMsg:
+		// Only the instances are filtered, and their filter is applied again
+		// as they refresh whichever panel is focused.
+		_, cmd = m.instances.Update(msg)
+
+	case instances.AuthStateMsg:
+		m.configurations.Update(msg)
+
+	case palette.OpenMsg:
+		m.showingPalette = true
+		m.palette.Update(msg)
+
+	case palette.ClosedMsg:
+		m.showingPalette = false
+
+	case serial.OpenMsg:
+		m.showingSerial = true
+		_, cmd = m.serial.Update(msg)
+
+	case serial.ClosedMsg:
+		m.showingSerial = false
+
+	case player.OpenMsg:
+		m.showingPlayer = true
+		_, cmd = m.player.Update(msg)
+
+	case player.ClosedMsg:
+		m.showingPlayer = false
+
+	case statusbar.NoticeMsg:
+		_, cmd = m.statusBar.Update(msg)
+
+	case dialog.ClosedMsg:
+		m.showingDialog = false
+
+	case dialog.RetryMsg:
+		// The failed connection was confirmed already, if protected.
+		if m.failed != nil {
+			retry := *m.failed
+			retry.options = msg.Options
+			m.connection = &retry
+			return m, tea.Quit
+		}
+
+	case views.OpenConsoleMsg:
+		cmd = openConsole(msg)
+
+	case consoleOpenedMsg:
+		_, cmd = m.statusBar.Update(statusbar.NoticeMsg{Text: msg.notice})
+
+	case views.SerialPortMsg:
+		return m, m.connect(&connection{
+			instance:       msg.Instance,
+			configName:     msg.ConfigName,
+			serviceAccount: msg.ServiceAccount,
+			serialPort:     true,
+		})
+
+	case confirm.ConfirmedMsg:
+		m.showingConfirm = false
+		if c := m.confirming; c != nil {
+			m.confirming = nil
+			c.reason = msg.Reason
+			m.connection = c
+			return m, tea.Quit
+		}
+
+	case confirm.ClosedMsg:
+		m.showingConfirm = false
+		m.confirming = nil
+
+	case clipboard.CopyMsg:
+		cmd = clipboard.Copy(msg)
+
+	case clipboard.CopiedMsg:
+		notice := "Copied " + msg.What
+		if msg.Err != nil {
+			notice = "Error copying " + msg.What + ": " + msg.Err.Error()
+		}
+		_, cmd = m.statusBar.Update(statusbar.NoticeMsg{Text: notice})
+
+	case quitMsg:
+		m.exited = true
+		return m, tea.Quit
+
+	case reloadMsg:
+		cmd = m.refreshInstances(true)
+
+	case showHelpMsg:
+		m.showingHelp = true
+
+	case loginMsg:
+		cmd = m.login(msg.applicationDefault)
+
+	case focusPanelMsg:
+		cmd = m.focus(msg.panel)
+
+	case maximizeMsg:
+		m.maximized = !m.maximized
+		cmd = m.setLayout()
+
+	case hist_view.ClearMsg:
+		_, cmd = m.history.Update(msg)
+
+	case configurations.ActivateMsg:
+		_, cmd = m.configurations.Update(msg)
+
+	case loginFinishedMsg:
+		cmd = m.refreshInstances(true)
 
 	case instances.FilteringStateMsg:
 		m.filtering = msg.Filtering
 
+	case configurations.EditingStateMsg:
+		m.editing = msg.Editing
+
 	case hist_view.ResultMsg:
 		m.history.Update(msg)
 
@@ -153,6 +615,30 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.history.Update(msg)
 
 	case tea.KeyMsg:
+		if m.showingConfirm {
+			_, cmd = m.confirm.Update(msg)
+			return m, cmd
+		}
+		if m.showingDialog {
+			_, cmd = m.dialog.Update(msg)
+			return m, cmd
+		}
+		if m.showingPalette {
+			_, cmd = m.palette.Update(msg)
+			return m, cmd
+		}
+		if m.showingSerial {
+			_, cmd = m.serial.Update(msg)
+			return m, cmd
+		}
+		if m.showingPlayer {
+			_, cmd = m.player.Update(msg)
+			return m, cmd
+		}
+		if m.editing {
+			_, cmd = m.configurations.Update(msg)
+			return m, cmd
+		}
 		if m.filtering {
 			switch m.activePanel {
 			case views.Instances:
@@ -161,56 +647,60 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		}
 
-		switch msg.String() {
-		case "q", "ctrl+c":
+		keys := views.Keys
+		if m.showingHelp {
+			switch {
+			case key.Matches(msg, keys.Help), msg.String() == "esc":
+				m.showingHelp = false
+			case key.Matches(msg, keys.Quit):
+				m.exited = true
+				return m, tea.Quit
+			}
+			return m, nil
+		}
+
+		switch {
+		case key.Matches(msg, keys.Quit):
 			m.exited = true
 			return m, tea.Quit
 
-		case "left", "shift+tab":
-			m.activePanel = (m.activePanel - 1 + 3) % 3
-			m.updateFocus()
+		case key.Matches(msg, keys.Help):
+			m.showingHelp = true
+
+		case key.Matches(msg, keys.Palette):
+			m.showingPalette = true
+			m.palette.Update(palette.OpenMsg{Commands: m.commands()})
 
-		case "right", "tab":
-			m.activePanel = (m.activePanel + 1) % 3
-			m.updateFocus()
+		case key.Matches(msg, keys.PrevPanel):
+			cmds = append(cmds, m.cyclePanel(-1))
 
-		case "/":
+		case key.Matches(msg, keys.NextPanel):
+			cmds = append(cmds, m.cyclePanel(1))
+
+		case key.Matches(msg, keys.Maximize):
+			m.maximized = !m.maximized
+			cmds = append(cmds, m.setLayout())
+
+		case key.Matches(msg, keys.Filter):
 			m.filtering = true
-			m.activePanel = views.Instances
-			m.updateFocus()
+			cmds = append(cmds, m.focus(views.Instances))
 			m.instances.Update(msg)
 
-		case "r":
-			_, refreshCmd := m.instances.Update(instances.RefreshMsg{
-				ConfigName: m.selectedConfiguration.Name,
-				ClearCache: true,
-			})
-			cmds = append(cmds, refreshCmd)
+		case key.Matches(msg, keys.Reload):
+			cmds = append(cmds, m.refreshInstances(true))
+
+		case key.Matches(msg, keys.Login):
+			cmds = append(cmds, m.login(false))
+
+		case key.Matches(msg, keys.LoginADC):
+			cmds = append(cmds, m.login(true))
 
-		case "c":
+		case key.Matches(msg, keys.ClearHistory):
 			_, clearCmd := m.history.Update(hist_view.ClearMsg{})
 			cmds = append(cmds, clearCmd)
 
-		case "0":
-			cmds = append(cmds, m.speedDial(msg, 0))
-		case "1":
-			cmds = append(cmds, m.speedDial(msg, 1))
-		case "2":
-			cmds = append(cmds, m.speedDial(msg, 2))
-		case "3":
-			cmds = append(cmds, m.speedDial(msg, 3))
-		case "4":
-			cmds = append(cmds, m.speedDial(msg, 4))
-		case "5":
-			cmds = append(cmds, m.speedDial(msg, 5))
-		case "6":
-			cmds = append(cmds, m.speedDial(msg, 6))
-		case "7":
-			cmds = append(cmds, m.speedDial(msg, 7))
-		case "8":
-			cmds = append(cmds, m.speedDial(msg, 8))
-		case "9":
-			cmds = append(cmds, m.speedDial(msg, 9))
+		case key.Matches(msg, keys.SpeedDial):
+			cmds = append(cmds, m.speedDial(msg, keys.SpeedDialIndex(msg.String())))
 
 		default:
 			switch m.activePanel {
@@ -223,33 +713,73 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		}
 
-	case tea.WindowSizeMsg:
-		return m, func() tea.Msg {
-			return m.layout.Resize(msg.Width, msg.Height)
+	case tea.MouseMsg:
+		if m.showingDialog || m.showingConfirm {
+			break
+		}
+		if m.showingSerial {
+			_, cmd = m.serial.Update(msg)
+			break
 		}
+		if m.showingPlayer {
+			_, cmd = m.player.Update(msg)
+			break
+		}
+		cmd = m.mouse(msg)
+
+	case tea.WindowSizeMsg:
+		m.help.Update(msg)
+		m.palette.Update(msg)
+		m.serial.Update(msg)
+		m.player.Update(msg)
+		m.dialog.Update(msg)
+		m.confirm.Update(msg)
+		m.windowSize = msg
+		return m, m.resize()
 
 	case bl.BubbleLayoutMsg:
-		m.configSize, _ = msg.Size(m.configurationsPanelId)
-		m.instSize, _ = msg.Size(m.instancesPanelId)
-		m.historySize, _ = msg.Size(m.historyPanelId)
+		for panel, id := range m.panelIds {
+			size, _ := msg.Size(id)
+			m.sizes[panel] = size
+			m.panel(panel).Update(size)
+		}
 		m.statusSize, _ = msg.Size(m.statusPanelId)
-		m.configurations.Update(m.configSize)
-		m.instances.Update(m.instSize)
-		m.history.Update(m.historySize)
 		m.statusBar.Update(m.statusSize)
 
 	case configurations.ConfigurationSelectedMsg:
 		m.selectedConfiguration = msg.Configuration
+		m.selectedProject = msg.Project
+		m.statusBar.Update(statusbar.SetIdentityMsg{Identity: msg.Configuration.Identity()})
+
+	case configurations.ProjectsResultMsg:
+		_, cmd = m.configurations.Update(msg)
 
 	case instances.InstanceSelectedMsg:
-		m.selectedInstance = msg.Instance
-		return m, tea.Quit
+		if m.selectedConfiguration == nil || msg.Instance == nil {
+			break
+		}
+		return m, m.connect(&connection{
+			instance:       msg.Instance,
+			configName:     m.selectedConfiguration.Name,
+			serviceAccount: m.selectedConfiguration.ServiceAccount(),
+		})
 
 	case hist_view.ConnectionSelectedMsg:
-		m.selectedHistoryConnection = msg.Connection
-		return m, tea.Quit
+		return m, m.connect(&connection{
+			instance:       msg.Connection.Instance,
+			configName:     msg.Connection.ConfigName,
+			serviceAccount: msg.Connection.ServiceAccount,
+		})
 
 	default:
+		if m.showingSerial {
+			_, cmd = m.serial.Update(msg)
+			break
+		}
+		if m.showingPlayer {
+			_, cmd = m.player.Update(msg)
+			break
+		}
 		switch m.activePanel {
 		case views.Instances:
 			_, cmd = m.instances.Update(msg)
@@ -265,72 +795,392 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 }
 
 func (m *model) View() string {
-	return lipgloss.JoinVertical(
-		0, lipgloss.JoinHorizontal(
-			0,
-			views.BoxStyle(
-				m.configSize, false).Render(m.configurations.View()),
-			views.BoxStyle(
-				m.instSize, false).Render(m.instances.View()),
-		),
-		views.BoxStyle(
-			m.historySize, false).Render(m.history.View()),
-		views.BoxStyle(
-			m.statusSize, false).Render(m.statusBar.View()),
+	if m.showingConfirm {
+		return m.confirm.View()
+	}
+	if m.showingDialog {
+		return m.dialog.View()
+	}
+	if m.showingPalette {
+		return m.palette.View()
+	}
+	if m.showingSerial {
+		return m.serial.View()
+	}
+	if m.showingPlayer {
+		return m.player.View()
+	}
+	if m.showingHelp {
+		return m.help.View()
+	}
+	rows := make([]string, 0, len(m.panelLayout)+1)
+	for _, row := range m.panelLayout {
+		cells := make([]string, 0, len(row))
+		for _, cell := range row {
+			cells = append(cells, views.BoxStyle(m.sizes[cell.Panel], false).Render(m.panel(cell.Panel).View()))
+		}
+		rows = append(rows, lipgloss.JoinHorizontal(0, cells...))
+	}
+	rows = append(rows, views.BoxStyle(m.statusSize, false).Render(m.statusBar.View()))
+	return lipgloss.JoinVertical(0, rows...)
+}
+
+type consoleOpenedMsg struct{ notice string }
+
+// openConsole opens the Cloud Console page of the instance with the platform
+// URL opener.
+func openConsole(msg views.OpenConsoleMsg) tea.Cmd {
+	i := msg.Instance
+	return func() tea.Msg {
+		url := i.ConsoleURL()
+		var cmd *exec.Cmd
+		switch runtime.GOOS {
+		case "darwin":
+			cmd = exec.Command("open", url)
+		case "windows":
+			cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+		default:
+			cmd = exec.Command("xdg-open", url)
+		}
+		err := cmd.Start()
+		_ = gcloud.Audit(i.AuditEntry("console.open", msg.ConfigName, msg.ServiceAccount, map[string]string{"url": url}), err)
+		if err != nil {
+			return consoleOpenedMsg{"Error opening browser: " + err.Error()}
+		}
+		go func() {
+			_ = cmd.Wait()
+		}()
+		return consoleOpenedMsg{"Opened " + i.Name + " in the Cloud Console"}
+	}
+}
+
+func impersonationNotice(serviceAccount string) string {
+	if serviceAccount == "" {
+		return ""
+	}
+	return lipgloss.JoinHorizontal(
+		0,
+		lipgloss.NewStyle().Render(" via "),
+		lipgloss.NewStyle().Foreground(views.Colors.Info).Render(serviceAccount),
 	)
 }
 
+const (
+	reconnectDelay    = time.Second
+	maxReconnectDelay = 30 * time.Second
+)
+
+// sshSession opens an SSH session on the instance, through gcloud or the
+// native client, printing it to stdout. Dropped connections are reconnected
+// with an increasing delay, until the attempts configured run out or Ctrl+C
+// cancels. It returns the user logged in as.
+func sshSession(c *connection, stdout io.Writer) (string, error) {
+	attempts := config.Config.SSH.ReconnectAttempts
+	delay := reconnectDelay
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		user, err := sshclient.Session(c.instance, c.configName, c.serviceAccount, c.options, stdout)
+		// The remote shell exiting with a status is a normal logout.
+		if err == nil || sshclient.Exited(err) {
+			return user, nil
+		}
+		if !sshclient.Dropped(err) {
+			return user, err
+		}
+		// A session that lasted got through, start over.
+		if time.Since(start) > maxReconnectDelay {
+			attempt, delay = 1, reconnectDelay
+		}
+		if attempt > attempts {
+			return user, err
+		}
+
+		fmt.Println()
+		fmt.Println(lipgloss.JoinHorizontal(
+			0,
+			lipgloss.NewStyle().Bold(true).Foreground(views.Colors.Error).Render("Connection lost: "),
+			lipgloss.NewStyle().Foreground(views.Colors.ErrorDetail).Render(err.Error()),
+		))
+		fmt.Printf("🔁 Reconnecting in %v (attempt %v/%v), Ctrl+C to cancel ...\n", delay, attempt, attempts)
+
+		interrupted := make(chan os.Signal, 1)
+		signal.Notify(interrupted, os.Interrupt)
+		select {
+		case <-time.After(delay):
+		case <-interrupted:
+			signal.Stop(interrupted)
+			return user, err
+		}
+		signal.Stop(interrupted)
+		delay = min(delay*2, maxReconnectDelay)
+		_ = c.audit("ssh.reconnect", map[string]string{"attempt": strconv.Itoa(attempt)}, err)
+	}
+}
+
+// record returns where to print the session: the terminal, and its
+// recording when enabled.
+func record(c *connection) (io.Writer, *recording.Recorder) {
+	if !config.Config.SSH.Record {
+		return os.Stdout, nil
+	}
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		width, height = 80, 24
+	}
+	recorder, err := recording.Start(c.instance.Name, fmt.Sprintf("[%v] %v", c.configName, c.instance.Name), width, height)
+	if err != nil {
+		fmt.Println(lipgloss.NewStyle().Foreground(views.Colors.Error).Render("Not recording the session: " + err.Error()))
+		return os.Stdout, nil
+	}
+	fmt.Println(lipgloss.NewStyle().Foreground(views.Colors.Muted).Render("⏺ Recording to " + recorder.Path()))
+	fmt.Println()
+	return io.MultiWriter(os.Stdout, recorder), recorder
+}
+
+// confirmOnTerminal asks to type the name of a protected instance, and for a
+// reason, when stdin and stdout carry the proxied connection.
+func confirmOnTerminal(c *connection) (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("%v is protected, and there is no terminal to confirm the connection", c.instance.Name)
+	}
+	defer func() {
+		_ = tty.Close()
+	}()
+
+	reader := bufio.NewReader(tty)
+	fmt.Fprintf(tty, "🛡️ [%v] -> %v is protected. Type its name to connect: ", c.configName, c.instance.Name)
+	name, _ := reader.ReadString('\n')
+	if strings.TrimSpace(name) != c.instance.Name {
+		return "", errors.New("the name does not match")
+	}
+	fmt.Fprint(tty, "Reason (optional): ")
+	reason, _ := reader.ReadString('\n')
+	return strings.TrimSpace(reason), nil
+}
+
+const usage = `Usage: gssh [command]
+
+Without a command, gssh starts the interactive UI.
+
+Commands:
+  ssh-config    Write OpenSSH Host entries for the cached instances
+  proxy [--iap] <instance> [port]
+                Relay stdin and stdout to an instance, for use as an OpenSSH
+                ProxyCommand, e.g. ProxyCommand gssh proxy %n %p
+  audit [--since 24h|2006-01-02] [--action ssh] [--user name]
+        [--config name] [--instance name] [--json]
+                Show the audit log of the actions gssh performed
+`
+
+// runCommand runs the command line subcommands, which do not start the UI.
+func runCommand(args []string) {
+	switch args[0] {
+	case "ssh-config":
+		file, err := sshconfig.Write()
+		if err != nil {
+			fmt.Println("Error writing SSH config:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Wrote %v, kept up to date as gssh refreshes instances.\n", file)
+		fmt.Printf("Add this line at the top of ~/.ssh/config to use it:\n\n  Include %v\n", file)
+	case "proxy":
+		// stdout carries the connection, errors go to stderr.
+		flags := flag.NewFlagSet("proxy", flag.ExitOnError)
+		iap := flags.Bool("iap", false, "always connect through an IAP tunnel")
+		_ = flags.Parse(args[1:])
+		if flags.NArg() < 1 || flags.NArg() > 2 {
+			fmt.Fprintf(os.Stderr, "%v", usage)
+			os.Exit(2)
+		}
+		port := "22"
+		if flags.NArg() == 2 {
+			port = flags.Arg(1)
+		}
+
+		target, err := proxy.Resolve(flags.Arg(0))
+		if err == nil {
+			proxied := &connection{instance: target.Instance, configName: target.ConfigName, serviceAccount: target.ServiceAccount}
+			if proxied.instance.Protected(proxied.configName) {
+				proxied.reason, err = confirmOnTerminal(proxied)
+			}
+			if err == nil {
+				details := map[string]string{"port": port, "iap": strconv.FormatBool(*iap)}
+				if err = proxied.auditStart("proxy", details); err == nil {
+					err = proxy.Connect(target, port, *iap)
+					_ = proxied.audit("proxy.end", details, err)
+				}
+			}
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "gssh proxy:", err)
+			os.Exit(1)
+		}
+	case "audit":
+		flags := flag.NewFlagSet("audit", flag.ExitOnError)
+		since := flags.String("since", "", "only show entries since a duration ago, or a date")
+		var q audit.Query
+		flags.StringVar(&q.Action, "action", "", "only show an action, such as ssh or configuration")
+		flags.StringVar(&q.User, "user", "", "only show the actions of a local user")
+		flags.StringVar(&q.Configuration, "config", "", "only show the actions on a configuration")
+		flags.StringVar(&q.Instance, "instance", "", "only show the actions on an instance")
+		asJSON := flags.Bool("json", false, "print the entries as JSON lines")
+		_ = flags.Parse(args[1:])
+		if *since != "" {
+			var err error
+			if q.Since, err = audit.ParseSince(*since); err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(2)
+			}
+		}
+
+		entries, err := audit.Read()
+		if err != nil {
+			fmt.Println("Error reading the audit log:", err)
+			os.Exit(1)
+		}
+		var matching []audit.Entry
+		for _, e := range entries {
+			if q.Matches(e) {
+				matching = append(matching, e)
+			}
+		}
+		if *asJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			for _, e := range matching {
+				_ = encoder.Encode(e)
+			}
+			return
+		}
+		if len(matching) == 0 {
+			fmt.Printf("No entries in %v.\n", audit.Path())
+			return
+		}
+		_ = audit.Print(os.Stdout, matching)
+	case "help", "-h", "--help":
+		fmt.Printf("%v", usage)
+	default:
+		fmt.Printf("Unknown command %q\n\n%v", args[0], usage)
+		os.Exit(2)
+	}
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1:])
+		return
+	}
+
+	gcloud.CacheWritten = sshconfig.Refresh
+	// The model is kept across sessions, to come back to the UI as it was left.
+	m := initialModel()
 	for {
-		p := tea.NewProgram(initialModel(), tea.WithAltScreen(), tea.WithMouseCellMotion())
-		r, err := p.Run()
+		p := tea.NewProgram(m, tea.WithAltScreen(), tea.WithMouseCellMotion())
+		// stderr would garble the UI.
+		gcloud.AuditFailed = func(err error) {
+			go p.Send(statusbar.NoticeMsg{Text: "⚠️ Error " + err.Error()})
+		}
+		_, err := p.Run()
+		gcloud.AuditFailed = nil
 		if err != nil {
 			fmt.Println("Error running program:", err)
 			os.Exit(1)
 		}
-		if m, ok := r.(*model); ok {
-			if m.exited {
-				fmt.Println("\n👋 See you soon!")
-				os.Exit(0)
+		m.saveState()
+		if m.exited {
+			fmt.Println("\n👋 See you soon!")
+			os.Exit(0)
+		}
+
+		if target := m.connection; target != nil && target.serialPort {
+			m.connection = nil
+			fmt.Println()
+			fmt.Println(lipgloss.JoinHorizontal(
+				0,
+				lipgloss.NewStyle().Bold(true).Render("🔌 Connecting to the serial port of "),
+				lipgloss.NewStyle().Foreground(views.Colors.Info).Render(fmt.Sprintf("[%v]", target.configName)),
+				lipgloss.NewStyle().Render(" -> "),
+				lipgloss.NewStyle().Foreground(views.Colors.Highlight).Render(target.instance.Name),
+				impersonationNotice(target.serviceAccount),
+				" ...",
+			))
+			fmt.Println()
+
+			err := target.auditStart("serial_port", nil)
+			if err == nil {
+				start := time.Now()
+				err = target.instance.SerialPort(target.configName, target.serviceAccount)
+				_ = target.audit("serial_port.end", map[string]string{"duration": time.Since(start).Round(time.Second).String()}, err)
+			}
+			if err != nil {
+				m.fail(target, fmt.Sprintf("Error connecting to the serial port of [%v] -> %v", target.configName, target.instance.Name), err)
+				continue
 			}
+			fmt.Println("\n🛬 Serial console closed.")
+		}
 
-			var selectedInstance *gcloud.Instance
-			var selectedConfiguration string
-			if m.selectedInstance != nil && m.selectedConfiguration != nil {
-				selectedInstance = m.selectedInstance
-				selectedConfiguration = m.selectedConfiguration.Name
+		if c := m.connection; c != nil {
+			m.connection = nil
+			userName := c.options.UserName
+			if userName == "" {
+				userName = config.Config.SSH.UserName
 			}
-			if m.selectedHistoryConnection != nil {
-				selectedInstance = m.selectedHistoryConnection.Instance
-				selectedConfiguration = m.selectedHistoryConnection.ConfigName
+			if c.options.OSLogin() {
+				userName = "your OS Login user"
 			}
+			fmt.Println()
+			fmt.Println(lipgloss.JoinHorizontal(
+				0,
+				lipgloss.NewStyle().Bold(true).Render("🚀 SSHing to instance "),
+				lipgloss.NewStyle().Foreground(views.Colors.Info).Render(fmt.Sprintf("[%v]", c.configName)),
+				lipgloss.NewStyle().Render(" -> "),
+				lipgloss.NewStyle().Foreground(views.Colors.Highlight).Render(fmt.Sprintf("%v\n", c.instance.Name)),
+				lipgloss.NewStyle().Render(" as "),
+				lipgloss.NewStyle().Foreground(views.Colors.Info).Render(userName),
+				impersonationNotice(c.serviceAccount),
+				" ...",
+			))
+			fmt.Println()
 
-			if selectedInstance != nil {
-				fmt.Println()
-				fmt.Println(lipgloss.JoinHorizontal(
-					0,
-					lipgloss.NewStyle().Bold(true).Render("🚀 SSHing to instance "),
-					lipgloss.NewStyle().Foreground(lipgloss.Color("#7275ff")).Render(fmt.Sprintf("[%v]", selectedConfiguration)),
-					lipgloss.NewStyle().Render(" -> "),
-					lipgloss.NewStyle().Foreground(lipgloss.Color("#ee6ff8")).Render(fmt.Sprintf("%v\n", selectedInstance.Name)),
-					lipgloss.NewStyle().Render(" as "),
-					lipgloss.NewStyle().Foreground(lipgloss.Color("#7275ff")).Render(config.Config.SSH.UserName),
-					" ...",
-				))
-				fmt.Println()
-
-				history.AddConnection(selectedConfiguration, selectedInstance)
-				err = selectedInstance.SSH(selectedConfiguration)
-				if err != nil {
-					fmt.Println(lipgloss.JoinHorizontal(
-						0,
-						lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#ff253b")).Render("Error SSHing to instance: "),
-						lipgloss.NewStyle().Foreground(lipgloss.Color("#ff666b")).Render(err.Error()),
-					))
-					os.Exit(1)
-				}
-				fmt.Println("\n🛬 SSH session closed.")
+			stdout, recorder := record(c)
+			var recordingFile string
+			if recorder != nil {
+				recordingFile = recorder.Path()
+			}
+			client := "gcloud"
+			if c.options.Native() {
+				client = "native"
+			}
+			details := map[string]string{
+				"client": client,
+				"iap":    strconv.FormatBool(c.options.IAP),
+			}
+			// The OS Login user is logged once the session ends.
+			if !c.options.OSLogin() {
+				details["user"] = userName
+			}
+			if recordingFile != "" {
+				details["recording"] = recordingFile
+			}
+			err := c.auditStart("ssh", details)
+			if err == nil {
+				history.AddConnection(c.configName, c.serviceAccount, c.instance, recordingFile, c.reason)
+				start := time.Now()
+				var user string
+				user, err = sshSession(c, stdout)
+				_ = c.audit("ssh.end", map[string]string{
+					"user":     user,
+					"duration": time.Since(start).Round(time.Second).String(),
+				}, err)
+			}
+			if recorder != nil {
+				_ = recorder.Close()
+			}
+			if err != nil {
+				m.fail(c, fmt.Sprintf("Error SSHing to [%v] -> %v", c.configName, c.instance.Name), err)
+				continue
 			}
+			fmt.Println("\n🛬 SSH session closed.")
 		}
 	}
 }
@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"fmt"
+	"gssh/gcloud"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const dialTimeout = 10 * time.Second
+
+// Target is an instance along with the configuration and service account to
+// reach it with.
+type Target struct {
+	Instance       *gcloud.Instance
+	ConfigName     string
+	ServiceAccount string
+}
+
+// Resolve finds the instance named host, either "name" or
+// "name.configuration" as in the Host entries of gssh ssh-config. The
+// instances cache is searched first, then every configuration through
+// gcloud.
+func Resolve(host string) (*Target, error) {
+	name, configName, _ := strings.Cut(host, ".")
+
+	caches, err := gcloud.ListCachedInstances()
+	if err != nil {
+		return nil, err
+	}
+	for _, cache := range caches {
+		if configName != "" && cache.ConfigName != configName {
+			continue
+		}
+		for _, inst := range cache.Instances {
+			if inst.Name == name {
+				return &Target{inst, cache.ConfigName, cache.ServiceAccount}, nil
+			}
+		}
+	}
+
+	configurations, err := gcloud.ListConfigurations()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range configurations {
+		if configName != "" && c.Name != configName {
+			continue
+		}
+		instances, _, err := gcloud.ListInstances(c.Name, "", c.ServiceAccount(), false)
+		if err != nil {
+			continue
+		}
+		for _, inst := range instances {
+			if inst.Name == name {
+				return &Target{inst, c.Name, c.ServiceAccount()}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("instance %v not found", host)
+}
+
+// Connect relays stdin and stdout to port of the target, straight to its
+// external IP when it has one, or through an IAP tunnel.
+func Connect(t *Target, port string, iap bool) error {
+	if iap || t.Instance.ExternalIP == "" {
+		return t.Instance.IAPTunnel(port, t.ConfigName, t.ServiceAccount)
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(t.Instance.ExternalIP, port), dialTimeout)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	go func() {
+		_, _ = io.Copy(conn, os.Stdin)
+		// Let the server see the end of the input, and still read its output.
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			_ = tcp.CloseWrite()
+		}
+	}()
+	_, err = io.Copy(os.Stdout, conn)
+	return err
+}
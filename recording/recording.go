@@ -0,0 +1,148 @@
+package recording
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+var recordingsDir string
+
+func init() {
+	userConfigDir, _ := os.UserHomeDir()
+	recordingsDir = path.Join(userConfigDir, ".gssh", "recordings")
+}
+
+// Header is the first line of an asciicast v2 file.
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Event is output printed Time after the start of the recording.
+type Event struct {
+	Time time.Duration
+	Data string
+}
+
+// Recorder writes the output of a session as an asciicast v2 file.
+type Recorder struct {
+	file    *os.File
+	start   time.Time
+	mu      sync.Mutex
+	pending []byte
+}
+
+// Start records to a new file named after the instance, for a terminal of
+// width by height.
+func Start(instance string, title string, width int, height int) (*Recorder, error) {
+	if err := os.MkdirAll(recordingsDir, 0700); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	file, err := os.OpenFile(
+		path.Join(recordingsDir, fmt.Sprintf("%v-%v.cast", instance, start.Format("20060102-150405"))),
+		os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	header, _ := json.Marshal(Header{
+		Version:   2,
+		Width:     width,
+		Height:    height,
+		Timestamp: start.Unix(),
+		Title:     title,
+		Env:       map[string]string{"TERM": os.Getenv("TERM"), "SHELL": os.Getenv("SHELL")},
+	})
+	if _, err := fmt.Fprintf(file, "%s\n", header); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return &Recorder{file: file, start: start}, nil
+}
+
+func (r *Recorder) Path() string {
+	return r.file.Name()
+}
+
+// Write records p as an output event. A multi-byte character split across
+// writes is held back until complete, as events must be valid UTF-8.
+func (r *Recorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data := append(r.pending, p...)
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	r.pending = append([]byte(nil), data[cut:]...)
+	if cut == 0 {
+		return len(p), nil
+	}
+
+	event, _ := json.Marshal([]any{time.Since(r.start).Seconds(), "o", string(data[:cut])})
+	if _, err := fmt.Fprintf(r.file, "%s\n", event); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (r *Recorder) Close() error {
+	return r.file.Close()
+}
+
+// Load reads the header and output events of an asciicast v2 file.
+func Load(file string) (*Header, []Event, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	if !scanner.Scan() {
+		return nil, nil, fmt.Errorf("%v is empty", file)
+	}
+	var header Header
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return nil, nil, err
+	}
+	if header.Version != 2 {
+		return nil, nil, fmt.Errorf("unsupported asciicast version %v", header.Version)
+	}
+
+	var events []Event
+	for scanner.Scan() {
+		var raw []any
+		if err := json.Unmarshal(scanner.Bytes(), &raw); err != nil || len(raw) != 3 {
+			continue
+		}
+		at, _ := raw[0].(float64)
+		kind, _ := raw[1].(string)
+		data, _ := raw[2].(string)
+		if kind == "o" {
+			events = append(events, Event{time.Duration(at * float64(time.Second)), data})
+		}
+	}
+	return &header, events, scanner.Err()
+}
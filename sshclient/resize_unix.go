@@ -0,0 +1,29 @@
+//go:build !windows
+
+package sshclient
+
+import (
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchResize propagates the terminal size to the session on SIGWINCH, until
+// stopped.
+func watchResize(fd int, session *ssh.Session) func() {
+	resized := make(chan os.Signal, 1)
+	signal.Notify(resized, syscall.SIGWINCH)
+	go func() {
+		for range resized {
+			if width, height, err := term.GetSize(fd); err == nil {
+				_ = session.WindowChange(height, width)
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(resized)
+		close(resized)
+	}
+}
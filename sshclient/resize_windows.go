@@ -0,0 +1,34 @@
+package sshclient
+
+import (
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+	"time"
+)
+
+const resizePollInterval = 500 * time.Millisecond
+
+// watchResize propagates the terminal size to the session, until stopped.
+// Windows has no SIGWINCH, so the size is polled.
+func watchResize(fd int, session *ssh.Session) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(resizePollInterval)
+		defer ticker.Stop()
+		width, height, _ := term.GetSize(fd)
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			if w, h, err := term.GetSize(fd); err == nil && (w != width || h != height) {
+				width, height = w, h
+				_ = session.WindowChange(height, width)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
@@ -0,0 +1,417 @@
+package sshclient
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/muesli/cancelreader"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/term"
+	"gssh/config"
+	"gssh/gcloud"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	dialTimeout = 15 * time.Second
+	// keepaliveMaxMissed keepalives without a reply close the connection, as
+	// OpenSSH's ServerAliveCountMax.
+	keepaliveMaxMissed = 3
+)
+
+func init() {
+	switch config.Config.SSH.Client {
+	case "", "gcloud", "native":
+	default:
+		log.Fatalf("Error in [ssh] config: unknown client %q, expected gcloud or native", config.Config.SSH.Client)
+	}
+}
+
+// Options override the [ssh] config for a connection.
+type Options struct {
+	// Client is "gcloud" or "native", the configured client when empty.
+	Client   string
+	UserName string
+	// IAP connects through an IAP tunnel even to instances with an external
+	// IP.
+	IAP bool
+}
+
+// Native reports whether the connection uses the built-in client rather
+// than gcloud compute ssh.
+func (o Options) Native() bool {
+	if o.Client == "" {
+		return config.Config.SSH.Client == "native"
+	}
+	return o.Client == "native"
+}
+
+// OSLogin reports whether the user is the POSIX user of the OS Login
+// profile, only known once the key is registered.
+func (o Options) OSLogin() bool {
+	return o.Native() && config.Config.SSH.OSLogin && o.UserName == ""
+}
+
+// Session opens an interactive session on the instance, with gcloud or the
+// native client, printing it to stdout. It returns the user logged in as.
+func Session(inst *gcloud.Instance, configName string, serviceAccount string, opts Options, stdout io.Writer) (string, error) {
+	if opts.Native() {
+		return Connect(inst, configName, serviceAccount, opts, stdout)
+	}
+	user := opts.UserName
+	if user == "" {
+		user = config.Config.SSH.UserName
+	}
+	return user, inst.SSH(configName, serviceAccount, opts.UserName, opts.IAP, stdout)
+}
+
+func expand(file string) string {
+	home, _ := os.UserHomeDir()
+	if rest, ok := strings.CutPrefix(file, "~/"); ok {
+		return path.Join(home, rest)
+	}
+	return file
+}
+
+// KeyFile is the private key used to log in, by default the one gcloud
+// compute ssh generates and adds to the instance metadata.
+func KeyFile() string {
+	if config.Config.SSH.KeyFile == "" {
+		return expand("~/.ssh/google_compute_engine")
+	}
+	return expand(config.Config.SSH.KeyFile)
+}
+
+func knownHostsFile() string {
+	return expand("~/.gssh/known_hosts")
+}
+
+// Connect opens an interactive session on the instance, as Instance.SSH does
+// through gcloud. It returns the user logged in as, once known.
+func Connect(inst *gcloud.Instance, configName string, serviceAccount string, opts Options, stdout io.Writer) (string, error) {
+	auth, err := authMethods()
+	if err != nil {
+		return "", err
+	}
+	user := opts.UserName
+	if user == "" {
+		user = config.Config.SSH.UserName
+	}
+	if opts.OSLogin() {
+		if user, err = gcloud.AddOSLoginKey(configName, serviceAccount, KeyFile()+".pub"); err != nil {
+			return "", err
+		}
+	}
+	return user, connect(inst, configName, serviceAccount, user, auth, opts.IAP, stdout)
+}
+
+func connect(inst *gcloud.Instance, configName string, serviceAccount string, user string, auth []ssh.AuthMethod, iap bool, stdout io.Writer) error {
+	hostKeys, err := hostKeyCallback()
+	if err != nil {
+		return err
+	}
+
+	conn, err := dial(inst, configName, serviceAccount, iap)
+	if err != nil {
+		return err
+	}
+	// Instances are recreated with new addresses, so host keys are
+	// remembered by name instead.
+	alias := net.JoinHostPort(fmt.Sprintf("%v.%v.%v", inst.Name, path.Base(inst.Zone), inst.ProjectId()), "22")
+	c, chans, reqs, err := ssh.NewClientConn(conn, alias, &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+		Timeout:         dialTimeout,
+	})
+	if err != nil {
+		_ = conn.Close()
+		if tunnel, ok := conn.(*tunnelConn); ok && tunnel.stderr.Len() > 0 {
+			return fmt.Errorf("%w\n%v", err, strings.TrimSpace(tunnel.stderr.String()))
+		}
+		return err
+	}
+	client := ssh.NewClient(c, chans, reqs)
+	defer func() {
+		_ = client.Close()
+	}()
+
+	if interval := config.Config.SSH.KeepaliveInterval; interval > 0 {
+		done := make(chan struct{})
+		defer close(done)
+		go keepalive(client, time.Duration(interval)*time.Second, done)
+	}
+	return shell(client, stdout)
+}
+
+func authMethods() ([]ssh.AuthMethod, error) {
+	var methods []ssh.AuthMethod
+	key, err := os.ReadFile(KeyFile())
+	if err != nil {
+		return nil, fmt.Errorf("%w, run gcloud compute ssh once to generate it", err)
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	var passphrase *ssh.PassphraseMissingError
+	switch {
+	case err == nil:
+		methods = append(methods, ssh.PublicKeys(signer))
+	case errors.As(err, &passphrase):
+		// The agent holds the decrypted key.
+	default:
+		return nil, fmt.Errorf("reading %v: %w", KeyFile(), err)
+	}
+
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("%v is protected by a passphrase and no ssh-agent is running", KeyFile())
+	}
+	return methods, nil
+}
+
+// hostKeyCallback trusts the key of a host on first connection, and refuses
+// keys that changed since.
+func hostKeyCallback() (ssh.HostKeyCallback, error) {
+	file := knownHostsFile()
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	_ = f.Close()
+	known, err := knownhosts.New(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := known(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) {
+			return err
+		}
+		if len(keyErr.Want) > 0 {
+			host, _, _ := net.SplitHostPort(hostname)
+			return fmt.Errorf("the host key of %v changed, remove it from %v if the instance was recreated", host, file)
+		}
+		f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		_, err = fmt.Fprintln(f, knownhosts.Line([]string{hostname}, key))
+		return err
+	}, nil
+}
+
+// dial connects to the external IP of the instance, or through an IAP tunnel
+// when it has none.
+func dial(inst *gcloud.Instance, configName string, serviceAccount string, iap bool) (net.Conn, error) {
+	if inst.ExternalIP != "" && !iap {
+		return net.DialTimeout("tcp", net.JoinHostPort(inst.ExternalIP, "22"), dialTimeout)
+	}
+
+	cmd := inst.IAPTunnelCmd("22", configName, serviceAccount)
+	conn := &tunnelConn{cmd: cmd}
+	cmd.Stderr = &conn.stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	conn.WriteCloser, conn.ReadCloser = stdin, stdout
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// tunnelConn is the connection through gcloud start-iap-tunnel, over its
+// stdin and stdout.
+type tunnelConn struct {
+	cmd    *exec.Cmd
+	stderr bytes.Buffer
+	once   sync.Once
+	io.WriteCloser
+	io.ReadCloser
+}
+
+var _ net.Conn = &tunnelConn{}
+
+func (c *tunnelConn) Close() error {
+	c.once.Do(func() {
+		_ = c.WriteCloser.Close()
+		_ = c.cmd.Process.Kill()
+		_ = c.cmd.Wait()
+	})
+	return nil
+}
+
+func (c *tunnelConn) LocalAddr() net.Addr              { return &net.TCPAddr{} }
+func (c *tunnelConn) RemoteAddr() net.Addr             { return &net.TCPAddr{} }
+func (c *tunnelConn) SetDeadline(time.Time) error      { return nil }
+func (c *tunnelConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *tunnelConn) SetWriteDeadline(time.Time) error { return nil }
+
+// keepalive closes the connection when the server stops answering, so that
+// dropped connections do not hang the session.
+func keepalive(client *ssh.Client, interval time.Duration, done chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	missed := 0
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		reply := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			reply <- err
+		}()
+		select {
+		case <-done:
+			return
+		case err := <-reply:
+			if err != nil {
+				_ = client.Close()
+				return
+			}
+			missed = 0
+		case <-time.After(interval):
+			missed++
+			if missed >= keepaliveMaxMissed {
+				_ = client.Close()
+				return
+			}
+		}
+	}
+}
+
+func shell(client *ssh.Client, stdout io.Writer) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = session.Close()
+	}()
+
+	if config.Config.SSH.ForwardAgent {
+		sock := os.Getenv("SSH_AUTH_SOCK")
+		if sock == "" {
+			return fmt.Errorf("agent forwarding needs a running ssh-agent, SSH_AUTH_SOCK is not set")
+		}
+		if err := agent.ForwardToRemote(client, sock); err != nil {
+			return err
+		}
+		if err := agent.RequestAgentForwarding(session); err != nil {
+			return err
+		}
+	}
+
+	// The UI reads stdin again after the session, so the copy to the session
+	// must stop with it rather than swallow the next key press.
+	session.Stdin = os.Stdin
+	if stdin, err := cancelreader.NewReader(os.Stdin); err == nil {
+		defer stdin.Cancel()
+		session.Stdin = stdin
+	}
+	session.Stdout = stdout
+	session.Stderr = os.Stderr
+
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		width, height, err := term.GetSize(fd)
+		if err != nil {
+			return err
+		}
+		if err := requestPty(session, width, height); err != nil {
+			return err
+		}
+
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = term.Restore(fd, state)
+		}()
+		stop := watchResize(fd, session)
+		defer stop()
+	}
+
+	if err := session.Shell(); err != nil {
+		return err
+	}
+	return session.Wait()
+}
+
+// requestPty asks for a terminal of the type of the local one.
+func requestPty(session *ssh.Session, width int, height int) error {
+	termType := os.Getenv("TERM")
+	if termType == "" {
+		termType = "xterm-256color"
+	}
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	return session.RequestPty(termType, height, width, modes)
+}
+
+// Exited reports whether err is only the exit status of the remote shell,
+// which ends the session as a logout does.
+func Exited(err error) bool {
+	var remoteExit *ssh.ExitError
+	if errors.As(err, &remoteExit) {
+		return true
+	}
+	// ssh exits with the status of the remote shell, 255 being its own
+	// failures, while gcloud reports its own.
+	var gcloudErr *gcloud.Error
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() != 255 {
+		return !errors.As(err, &gcloudErr) || !gcloudErr.Failed()
+	}
+	return false
+}
+
+// Dropped reports whether err ended the session because the connection
+// failed or dropped, so that connecting again may work. Errors such as a
+// refused key or a changed host key are not.
+func Dropped(err error) bool {
+	if err == nil {
+		return false
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode() == 255
+	}
+	// The connection closed without the exit status of the shell, as when
+	// keepalives go unanswered.
+	var missing *ssh.ExitMissingError
+	var netErr net.Error
+	return errors.As(err, &missing) || errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed)
+}
@@ -0,0 +1,328 @@
+package sshclient
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"gssh/gcloud"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// session is what the test server saw of a session channel.
+type session struct {
+	requests []string
+	pty      struct {
+		Term          string
+		Columns, Rows uint32
+		Width, Height uint32
+		Modes         string
+	}
+}
+
+// testServer is an in-process SSH server accepting any client. Its shells
+// print "hello" and exit with exitStatus, or close without an exit status
+// when it is negative. Unless answerKeepalives is set, global requests are
+// left unanswered, as by a server that went away.
+type testServer struct {
+	exitStatus       int
+	answerKeepalives bool
+	sessions         chan *session
+}
+
+func (s *testServer) start(t *testing.T) string {
+	t.Helper()
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(newSigner(t))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+	s.sessions = make(chan *session, 1)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, config)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func (s *testServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	serverConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = serverConn.Close()
+	}()
+	go func() {
+		for req := range reqs {
+			if s.answerKeepalives {
+				_ = req.Reply(true, nil)
+			}
+		}
+	}()
+
+	for newChannel := range chans {
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		seen := &session{}
+		for req := range requests {
+			seen.requests = append(seen.requests, req.Type)
+			switch req.Type {
+			case "pty-req":
+				_ = ssh.Unmarshal(req.Payload, &seen.pty)
+				_ = req.Reply(true, nil)
+			case "shell":
+				_ = req.Reply(true, nil)
+				_, _ = io.WriteString(channel, "hello")
+				if s.exitStatus >= 0 {
+					status := struct{ Status uint32 }{uint32(s.exitStatus)}
+					_, _ = channel.SendRequest("exit-status", false, ssh.Marshal(&status))
+				}
+				_ = channel.Close()
+				s.sessions <- seen
+			default:
+				_ = req.Reply(false, nil)
+			}
+		}
+	}
+}
+
+func dialServer(t *testing.T, addr string) *ssh.Client {
+	t.Helper()
+	client, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            "conductor",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	return client
+}
+
+// withoutStdin runs the shell on /dev/null rather than the terminal running
+// the tests.
+func withoutStdin(t *testing.T) {
+	t.Helper()
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin := os.Stdin
+	os.Stdin = devNull
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		_ = devNull.Close()
+	})
+}
+
+func TestHostKeyCallback(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := os.MkdirAll(path.Join(home, ".gssh"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	hostname := "web-1.europe-west1-b.my-project:22"
+	remote := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 22}
+	key := newSigner(t).PublicKey()
+
+	callback, err := hostKeyCallback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := callback(hostname, remote, key); err != nil {
+		t.Fatalf("first connection: %v", err)
+	}
+	known, err := os.ReadFile(knownHostsFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(known), "web-1.europe-west1-b.my-project ") {
+		t.Errorf("known_hosts = %q, want the key of the host alias", known)
+	}
+
+	// A new address for the same instance is fine, a new key is not.
+	callback, err = hostKeyCallback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := callback(hostname, &net.TCPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 22}, key); err != nil {
+		t.Errorf("known key: %v", err)
+	}
+	err = callback(hostname, remote, newSigner(t).PublicKey())
+	if err == nil || !strings.Contains(err.Error(), "host key of web-1.europe-west1-b.my-project changed") {
+		t.Errorf("changed key: got %v, want it refused", err)
+	}
+}
+
+func exitError(t *testing.T, code int) error {
+	t.Helper()
+	err := exec.Command("sh", "-c", fmt.Sprintf("exit %d", code)).Run()
+	if err == nil {
+		t.Fatal("sh exited with 0")
+	}
+	return err
+}
+
+func TestDropped(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		dropped bool
+		exited  bool
+	}{
+		{"no error", nil, false, false},
+		{"remote exit status", &ssh.ExitError{Waitmsg: ssh.Waitmsg{}}, false, true},
+		{"exit status through gcloud", &gcloud.Error{Stderr: "Connection to web-1 closed.", Err: exitError(t, 1)}, false, true},
+		{"gcloud failure", &gcloud.Error{Stderr: "ERROR: (gcloud.compute.ssh) Could not fetch resource", Err: exitError(t, 1)}, false, false},
+		{"ssh failure", &gcloud.Error{Err: exitError(t, 255)}, true, false},
+		{"no exit status", &ssh.ExitMissingError{}, true, false},
+		{"dial", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true, false},
+		{"tunnel closed", fmt.Errorf("ssh: handshake failed: %w", io.EOF), true, false},
+		{"authentication", errors.New("ssh: handshake failed: ssh: unable to authenticate"), false, false},
+		{"missing key", fmt.Errorf("%w, run gcloud compute ssh once to generate it", os.ErrNotExist), false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Dropped(test.err); got != test.dropped {
+				t.Errorf("Dropped() = %v, want %v", got, test.dropped)
+			}
+			if got := Exited(test.err); got != test.exited {
+				t.Errorf("Exited() = %v, want %v", got, test.exited)
+			}
+		})
+	}
+}
+
+func TestKeepaliveClosesUnansweredConnection(t *testing.T) {
+	server := &testServer{}
+	client := dialServer(t, server.start(t))
+
+	done := make(chan struct{})
+	defer close(done)
+	go keepalive(client, 20*time.Millisecond, done)
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- client.Wait()
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the connection is still open after unanswered keepalives")
+	}
+}
+
+func TestKeepaliveKeepsAnsweredConnection(t *testing.T) {
+	server := &testServer{answerKeepalives: true}
+	client := dialServer(t, server.start(t))
+
+	done := make(chan struct{})
+	defer close(done)
+	go keepalive(client, 20*time.Millisecond, done)
+
+	time.Sleep(200 * time.Millisecond)
+	if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+		t.Fatalf("the connection was closed: %v", err)
+	}
+}
+
+func TestRequestPty(t *testing.T) {
+	t.Setenv("TERM", "xterm-test")
+	server := &testServer{}
+	client := dialServer(t, server.start(t))
+
+	s, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = s.Close()
+	}()
+	if err := requestPty(s, 120, 40); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Shell(); err != nil {
+		t.Fatal(err)
+	}
+	seen := <-server.sessions
+	if strings.Join(seen.requests, ",") != "pty-req,shell" {
+		t.Errorf("requests = %v, want pty-req then shell", seen.requests)
+	}
+	if seen.pty.Term != "xterm-test" || seen.pty.Columns != 120 || seen.pty.Rows != 40 {
+		t.Errorf("pty = %+v, want xterm-test 120x40", seen.pty)
+	}
+}
+
+func TestShell(t *testing.T) {
+	withoutStdin(t)
+	tests := []struct {
+		name       string
+		exitStatus int
+		exited     bool
+		dropped    bool
+	}{
+		{"logout", 0, false, false},
+		{"exit status", 3, true, false},
+		{"no exit status", -1, false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := &testServer{exitStatus: test.exitStatus}
+			client := dialServer(t, server.start(t))
+
+			var stdout bytes.Buffer
+			err := shell(client, &stdout)
+			if test.exitStatus == 0 && err != nil {
+				t.Fatalf("shell() = %v", err)
+			}
+			if Exited(err) != test.exited || Dropped(err) != test.dropped {
+				t.Errorf("shell() = %v, want exited %v and dropped %v", err, test.exited, test.dropped)
+			}
+			if stdout.String() != "hello" {
+				t.Errorf("stdout = %q, want the output of the shell", stdout.String())
+			}
+			seen := <-server.sessions
+			if !strings.Contains(strings.Join(seen.requests, ","), "shell") {
+				t.Errorf("requests = %v, want a shell", seen.requests)
+			}
+		})
+	}
+}
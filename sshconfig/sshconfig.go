@@ -0,0 +1,152 @@
+package sshconfig
+
+import (
+	"fmt"
+	"gssh/audit"
+	"gssh/config"
+	"gssh/gcloud"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const header = "# Generated by gssh from its instances cache. Changes will be overwritten.\n"
+
+// Path is the file holding the Host entries, to Include from ~/.ssh/config.
+func Path() string {
+	home, _ := os.UserHomeDir()
+	file := config.Config.SSH.ConfigFile
+	if file == "" {
+		return path.Join(home, ".gssh", "ssh_config")
+	}
+	if rest, ok := strings.CutPrefix(file, "~/"); ok {
+		return path.Join(home, rest)
+	}
+	return file
+}
+
+type host struct {
+	cache    gcloud.CachedInstances
+	instance *gcloud.Instance
+}
+
+// Generate renders a Host entry per cached instance, named after the
+// instance and its configuration. Instance names unique across
+// configurations also get an entry of their own.
+func Generate(caches []gcloud.CachedInstances) string {
+	seen := map[string]bool{}
+	count := map[string]int{}
+	var hosts []host
+	for _, cache := range caches {
+		for _, inst := range cache.Instances {
+			if inst.InternalIP == "" && inst.ExternalIP == "" {
+				continue
+			}
+			// The same instance may be cached through several projects or
+			// service accounts of a configuration.
+			id := strings.Join([]string{cache.ConfigName, inst.ProjectId(), path.Base(inst.Zone), inst.Name}, "/")
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			count[inst.Name]++
+			hosts = append(hosts, host{cache, inst})
+		}
+	}
+	sort.SliceStable(hosts, func(a, b int) bool {
+		return hosts[a].instance.Name < hosts[b].instance.Name
+	})
+
+	home, _ := os.UserHomeDir()
+	var b strings.Builder
+	b.WriteString(header)
+	for _, h := range hosts {
+		inst := h.instance
+		names := inst.Name + "." + h.cache.ConfigName
+		if count[inst.Name] == 1 {
+			names = inst.Name + " " + names
+		}
+		fmt.Fprintf(&b, "\nHost %v\n", names)
+		switch {
+		case inst.Protected(h.cache.ConfigName):
+			// gssh proxy asks for the confirmation and logs the connection.
+			fmt.Fprintf(&b, "  HostName %v\n", inst.Name)
+			fmt.Fprintf(&b, "  ProxyCommand %v proxy %v.%v %%p\n", executable(), inst.Name, h.cache.ConfigName)
+		case inst.ExternalIP != "":
+			fmt.Fprintf(&b, "  HostName %v\n", inst.ExternalIP)
+		default:
+			fmt.Fprintf(&b, "  HostName %v\n", inst.InternalIP)
+			fmt.Fprintf(&b, "  ProxyCommand %v\n", inst.IAPTunnelCommand(h.cache.ConfigName, h.cache.ServiceAccount))
+		}
+		fmt.Fprintf(&b, "  User %v\n", config.Config.SSH.UserName)
+		fmt.Fprintf(&b, "  IdentityFile %v\n", path.Join(home, ".ssh", "google_compute_engine"))
+	}
+	return b.String()
+}
+
+// executable is the path of gssh, for ProxyCommand to find it outside the
+// PATH too.
+func executable() string {
+	file, err := os.Executable()
+	if err != nil {
+		return "gssh"
+	}
+	if strings.ContainsAny(file, " \t") {
+		return fmt.Sprintf("%q", file)
+	}
+	return file
+}
+
+// Write generates the Host entries from the instances cache.
+func Write() (string, error) {
+	file := Path()
+	err := write(file)
+	_ = gcloud.Audit(audit.Entry{Action: "ssh_config.write", Details: map[string]string{"file": file}}, err)
+	return file, err
+}
+
+// mu serializes the writes, as caches are written by concurrent refreshes.
+var mu sync.Mutex
+
+// write replaces file at once, so that ssh never reads a partial one.
+func write(file string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	caches, err := gcloud.ListCachedInstances()
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(file)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(f.Name())
+	}()
+	_, err = f.WriteString(Generate(caches))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), file)
+}
+
+// Refresh rewrites the Host entries, when they were generated before, so
+// that they follow the instances cache.
+func Refresh() {
+	if _, err := os.Stat(Path()); err == nil {
+		_, _ = Write()
+	}
+}
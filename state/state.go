@@ -0,0 +1,51 @@
+package state
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+)
+
+// UI is the state of the interface restored when gssh starts again.
+type UI struct {
+	ActivePanel    int
+	Maximized      bool   `json:",omitempty"`
+	Configuration  string `json:",omitempty"`
+	Project        string `json:",omitempty"`
+	InstanceFilter string `json:",omitempty"`
+	Instance       string `json:",omitempty"`
+}
+
+// RestoreMsg is sent to the panels once, when the UI starts.
+type RestoreMsg struct {
+	UI UI
+}
+
+// Saver is implemented by the panels keeping part of the UI state.
+type Saver interface {
+	SaveState(s *UI)
+}
+
+var stateFile string
+
+func init() {
+	userConfigDir, _ := os.UserHomeDir()
+	stateFile = path.Join(userConfigDir, ".gssh", "state.json")
+}
+
+// Load returns the saved state, or the zero state when there is none.
+func Load() UI {
+	var s UI
+	if data, err := os.ReadFile(stateFile); err == nil {
+		_ = json.Unmarshal(data, &s)
+	}
+	return s
+}
+
+func Save(s UI) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(stateFile, data, 0644)
+}
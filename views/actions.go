@@ -0,0 +1,18 @@
+package views
+
+import "gssh/gcloud"
+
+// OpenConsoleMsg opens the Cloud Console page of an instance in the browser.
+type OpenConsoleMsg struct {
+	Instance       *gcloud.Instance
+	ConfigName     string
+	ServiceAccount string
+}
+
+// SerialPortMsg leaves the UI to connect to the serial port of an instance,
+// the same way selecting an instance leaves it for SSH.
+type SerialPortMsg struct {
+	Instance       *gcloud.Instance
+	ConfigName     string
+	ServiceAccount string
+}
@@ -0,0 +1,68 @@
+package clipboard
+
+import (
+	"github.com/aymanbagabas/go-osc52/v2"
+	tea "github.com/charmbracelet/bubbletea"
+	"gssh/gcloud"
+	"gssh/views/palette"
+	"os"
+)
+
+// CopyMsg asks to copy Text about Instance to the clipboard. What names it
+// for the user.
+type CopyMsg struct {
+	What           string
+	Text           string
+	Instance       *gcloud.Instance
+	ConfigName     string
+	ServiceAccount string
+}
+
+type CopiedMsg struct {
+	What string
+	Err  error
+}
+
+// Commands lists what can be copied about an instance, to pick from in the
+// command palette.
+func Commands(i *gcloud.Instance, configName string, serviceAccount string) []palette.Command {
+	copies := []CopyMsg{
+		{What: "name", Text: i.Name},
+		{What: "internal IP", Text: i.InternalIP},
+		{What: "external IP", Text: i.ExternalIP},
+		{What: "SSH command", Text: i.SSHCommand(configName, serviceAccount)},
+		{What: "console URL", Text: i.ConsoleURL()},
+	}
+	commands := make([]palette.Command, 0, len(copies))
+	for _, c := range copies {
+		if c.Text == "" {
+			continue
+		}
+		c.Instance, c.ConfigName, c.ServiceAccount = i, configName, serviceAccount
+		commands = append(commands, palette.Command{
+			Title: "Copy " + c.What + " of " + i.Name,
+			Hint:  c.Text,
+			Msg:   c,
+		})
+	}
+	return commands
+}
+
+// Copy sets the clipboard of the terminal with an OSC52 escape sequence, which
+// also works over SSH and inside tmux or screen.
+func Copy(msg CopyMsg) tea.Cmd {
+	return func() tea.Msg {
+		seq := osc52.New(msg.Text)
+		if os.Getenv("TMUX") != "" {
+			seq = seq.Tmux()
+		} else if os.Getenv("STY") != "" {
+			seq = seq.Screen()
+		}
+		_, err := seq.WriteTo(os.Stderr)
+		if msg.Instance != nil {
+			details := map[string]string{"what": msg.What, "text": msg.Text}
+			_ = gcloud.Audit(msg.Instance.AuditEntry("clipboard.copy", msg.ConfigName, msg.ServiceAccount, details), err)
+		}
+		return CopiedMsg{What: msg.What, Err: err}
+	}
+}
@@ -1,67 +1,102 @@
 package configurations
 
 import (
+	"fmt"
+	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	bl "github.com/winder/bubblelayout"
 	"gssh/gcloud"
+	"gssh/state"
 	"gssh/views"
 	"gssh/views/instances"
+	"gssh/views/palette"
 )
 
 var _ tea.Model = &Model{}
 
 type FocusMsg struct{}
 type BlurMsg struct{}
-type ConfigurationSelectedMsg struct{ Configuration *gcloud.Configuration }
+type ConfigurationSelectedMsg struct {
+	Configuration *gcloud.Configuration
+	Project       string
+}
 type RefreshMsg struct{}
+type ActivateMsg struct {
+	Name string
+}
+type EditingStateMsg struct {
+	Editing bool
+}
 
 type ErrMsg struct {
 	err error
 }
 type ResultMsg struct {
 	configurations []*gcloud.Configuration
-	items          []list.Item
-	activeIdx      int
 }
+type ProjectsResultMsg struct {
+	configName string
+	projects   []*gcloud.Project
+	err        error
+}
+
+type noticeItem struct {
+	text string
+}
+
+func (n noticeItem) Title() string       { return "  ↳ " + n.text }
+func (n noticeItem) Description() string { return "" }
+func (n noticeItem) FilterValue() string { return "" }
+
 type Model struct {
 	size           bl.Size
 	list           list.Model
 	error          error
 	configurations []*gcloud.Configuration
 	focused        bool
+	form           *form
+	picker         *picker
+
+	expanded      map[string]bool
+	projects      map[string][]*gcloud.Project
+	projectErrors map[string]error
+	authExpired   map[string]bool
+	// impersonation is the service account picked for a configuration,
+	// empty when picking the account itself.
+	impersonation map[string]string
+	// restoreProject is selected once the projects of the selected
+	// configuration are loaded.
+	restoreProject string
 }
 
 func InitialModel() *Model {
-	configs, err := gcloud.ListConfigurations()
-	if err != nil {
-		return &Model{
-			error: err,
-		}
-	}
-
-	var activeConfigIdx int
-	items := make([]list.Item, 0)
-	for i, config := range configs {
-		items = append(items, config)
-		if config.Active {
-			activeConfigIdx = i
-		}
-	}
-
-	l := list.New(items, list.NewDefaultDelegate(), 0, 0)
+	l := list.New([]list.Item{}, newDelegate(), 0, 0)
 	l.Title = "Select a GCP configuration:"
+	l.Styles.Title = l.Styles.Title.Foreground(views.Colors.AccentText)
 	l.SetShowStatusBar(false)
 	l.SetShowHelp(false)
+	l.DisableQuitKeybindings()
 	l.SetFilteringEnabled(false)
-	l.Select(activeConfigIdx)
 
-	return &Model{
-		list:           l,
-		configurations: configs,
-		focused:        true,
+	m := &Model{
+		list:          l,
+		focused:       true,
+		expanded:      map[string]bool{},
+		projects:      map[string][]*gcloud.Project{},
+		projectErrors: map[string]error{},
+		authExpired:   map[string]bool{},
+		impersonation: map[string]string{},
+	}
+
+	configs, err := gcloud.ListConfigurations()
+	if err != nil {
+		m.error = err
+		return m
 	}
+	m.setConfigurations(configs)
+	return m
 }
 
 func RefreshConfigurations() tea.Msg {
@@ -69,31 +104,168 @@ func RefreshConfigurations() tea.Msg {
 	if err != nil {
 		return ErrMsg{err}
 	}
+	return ResultMsg{configs}
+}
+
+func RefreshProjects(configName string) tea.Msg {
+	projects, err := gcloud.ListProjects(configName)
+	return ProjectsResultMsg{configName, projects, err}
+}
+
+func (m *Model) setConfigurations(configs []*gcloud.Configuration) {
+	m.configurations = configs
+	for _, config := range configs {
+		config.AuthExpired = m.authExpired[config.Name]
+		if sa, ok := m.impersonation[config.Name]; ok {
+			config.ImpersonateOverride = &sa
+		}
+	}
+	m.list.SetItems(m.items())
+	for _, config := range configs {
+		if config.Active {
+			m.selectConfiguration(config.Name)
+		}
+	}
+}
+
+// items flattens the configurations and the projects of the expanded ones
+// into the list rows.
+func (m *Model) items() []list.Item {
 	items := make([]list.Item, 0)
-	var activeConfigIdx int
-	for i, config := range configs {
+	for _, config := range m.configurations {
 		items = append(items, config)
-		if config.Active {
-			activeConfigIdx = i
+		if !m.expanded[config.Name] {
+			continue
+		}
+		if err, ok := m.projectErrors[config.Name]; ok {
+			items = append(items, noticeItem{fmt.Sprintf("⚠️ %v", err)})
+			continue
+		}
+		projects, ok := m.projects[config.Name]
+		if !ok {
+			items = append(items, noticeItem{"Loading projects..."})
+			continue
+		}
+		if len(projects) == 0 {
+			items = append(items, noticeItem{"No accessible projects"})
+		}
+		for _, p := range projects {
+			items = append(items, p)
+		}
+	}
+	return items
+}
+
+func (m *Model) selectConfiguration(name string) {
+	for i, item := range m.list.Items() {
+		if c, ok := item.(*gcloud.Configuration); ok && c.Name == name {
+			m.list.Select(i)
+			return
+		}
+	}
+}
+
+func (m *Model) selectProject(configName string, projectId string) bool {
+	for i, item := range m.list.Items() {
+		if p, ok := item.(*gcloud.Project); ok && p.ConfigName == configName && p.ProjectId == projectId {
+			m.list.Select(i)
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Model) SaveState(s *state.UI) {
+	if selected := m.selected(); selected != nil {
+		s.Configuration = selected.Name
+		s.Project = m.selectedProject()
+	}
+}
+
+func (m *Model) configuration(name string) *gcloud.Configuration {
+	for _, c := range m.configurations {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// selected returns the highlighted configuration, or the configuration owning
+// the highlighted project.
+func (m *Model) selected() *gcloud.Configuration {
+	switch item := m.list.SelectedItem().(type) {
+	case *gcloud.Configuration:
+		return item
+	case *gcloud.Project:
+		return m.configuration(item.ConfigName)
+	}
+	return nil
+}
+
+func (m *Model) selectedProject() string {
+	if p, ok := m.list.SelectedItem().(*gcloud.Project); ok {
+		return p.ProjectId
+	}
+	return ""
+}
+
+func (m *Model) toggleProjects() tea.Cmd {
+	selected := m.selected()
+	if selected == nil {
+		return nil
+	}
+	name := selected.Name
+	m.expanded[name] = !m.expanded[name]
+	m.list.SetItems(m.items())
+	m.selectConfiguration(name)
+	if !m.expanded[name] {
+		return nil
+	}
+	delete(m.projectErrors, name)
+	return func() tea.Msg {
+		return RefreshProjects(name)
+	}
+}
+
+func editingState(editing bool) tea.Cmd {
+	return func() tea.Msg {
+		return EditingStateMsg{Editing: editing}
+	}
+}
+
+func (m *Model) openForm(f *form) tea.Cmd {
+	m.form = f
+	return editingState(true)
+}
+
+func (m *Model) activate(config *gcloud.Configuration) tea.Cmd {
+	if config == nil {
+		return nil
+	}
+	config.Activating = true
+	return func() tea.Msg {
+		if err := gcloud.ActivateConfiguration(config.Name); err != nil {
+			return ErrMsg{err}
 		}
+		return RefreshMsg{}
+	}
+}
 
+func (m *Model) Commands() []palette.Command {
+	commands := make([]palette.Command, 0, len(m.configurations))
+	for _, config := range m.configurations {
+		commands = append(commands, palette.Command{
+			Title: "Switch to configuration " + config.Name,
+			Hint:  config.Project,
+			Msg:   ActivateMsg{Name: config.Name},
+		})
 	}
-	return ResultMsg{configs, items, activeConfigIdx}
+	return commands
 }
 
 func (m *Model) Init() tea.Cmd {
-	return tea.Batch(
-		func() tea.Msg {
-			return ConfigurationSelectedMsg{
-				Configuration: m.list.SelectedItem().(*gcloud.Configuration),
-			}
-		},
-		func() tea.Msg {
-			return instances.RefreshMsg{
-				ConfigName: m.list.SelectedItem().(*gcloud.Configuration).Name,
-			}
-		},
-	)
+	return m.selectionChanged(true)
 }
 
 func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -103,20 +275,121 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case BlurMsg:
 		m.focused = false
 
+	case formDoneMsg:
+		m.form = nil
+		return m, tea.Batch(
+			editingState(false),
+			func() tea.Msg {
+				return RefreshConfigurations()
+			},
+		)
+
+	case serviceAccountsMsg:
+		if m.picker != nil {
+			m.picker.loading = false
+			m.picker.error = msg.err
+			if msg.err == nil {
+				m.picker.setAccounts(msg.accounts)
+			}
+		}
+		return m, nil
+
+	case pickedMsg:
+		selected := m.selected()
+		if selected == nil {
+			return m, nil
+		}
+		sa := msg.serviceAccount
+		m.impersonation[selected.Name] = sa
+		selected.ImpersonateOverride = &sa
+		return m, m.selectionChanged(true)
+
+	case formErrMsg:
+		if m.form != nil {
+			m.form.busy = false
+			m.form.error = msg.err
+		}
+		return m, nil
+
 	case tea.KeyMsg:
-		switch msg.String() {
-		case "esc":
+		if m.picker != nil {
+			open, cmd := m.picker.update(msg)
+			if !open {
+				m.picker = nil
+				return m, tea.Batch(editingState(false), cmd)
+			}
+			return m, cmd
+		}
+		if m.form != nil {
+			open, cmd := m.form.update(msg)
+			if !open {
+				m.form = nil
+				return m, editingState(false)
+			}
+			return m, cmd
+		}
+
+		switch {
+		case key.Matches(msg, views.Keys.NewConfiguration):
+			return m, m.openForm(newCreateForm())
+		case key.Matches(msg, views.Keys.CloneConfiguration):
+			if selected := m.selected(); selected != nil {
+				return m, m.openForm(newCloneForm(selected))
+			}
 			return m, nil
-		case "enter":
-			m.list.SelectedItem().(*gcloud.Configuration).Activating = true
-			return m, func() tea.Msg {
-				if err := gcloud.ActivateConfiguration(m.list.SelectedItem().(*gcloud.Configuration).Name); err != nil {
-					return ErrMsg{err}
-				}
-				return RefreshMsg{}
+		case key.Matches(msg, views.Keys.RenameConfiguration):
+			if selected := m.selected(); selected != nil {
+				return m, m.openForm(newRenameForm(selected))
+			}
+			return m, nil
+		case key.Matches(msg, views.Keys.Expand):
+			return m, m.toggleProjects()
+		case key.Matches(msg, views.Keys.Impersonate):
+			selected := m.selected()
+			if selected == nil {
+				return m, nil
+			}
+			x, y := views.PanelStyle.GetFrameSize()
+			p, cmd := newPicker(selected, m.selectedProject(), m.size.Width-x, m.size.Height-y-2)
+			m.picker = p
+			return m, tea.Batch(editingState(true), cmd)
+		case key.Matches(msg, views.Keys.DeleteConfiguration):
+			if selected := m.selected(); selected != nil {
+				return m, m.openForm(newDeleteForm(selected))
 			}
+			return m, nil
+		case msg.String() == "esc":
+			return m, nil
+		case key.Matches(msg, views.Keys.Select):
+			return m, m.activate(m.selected())
 		}
 
+	case views.ClickMsg:
+		index := views.ListItemAt(m.list, msg.Y)
+		if index < 0 {
+			return m, nil
+		}
+		changed := index != m.list.Index()
+		m.list.Select(index)
+		cmds := []tea.Cmd{m.selectionChanged(changed)}
+		if msg.Double {
+			cmds = append(cmds, m.activate(m.selected()))
+		}
+		return m, tea.Batch(cmds...)
+
+	case views.WheelMsg:
+		index := m.list.Index()
+		if msg.Down {
+			m.list.CursorDown()
+		} else {
+			m.list.CursorUp()
+		}
+		return m, m.selectionChanged(index != m.list.Index())
+
+	case ActivateMsg:
+		m.selectConfiguration(msg.Name)
+		return m, tea.Batch(m.activate(m.configuration(msg.Name)), m.selectionChanged(true))
+
 	case bl.Size:
 		x, y := views.PanelStyle.GetFrameSize()
 		m.size = msg
@@ -128,9 +401,45 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 
 	case ResultMsg:
-		m.configurations = msg.configurations
-		m.list.SetItems(msg.items)
-		m.list.Select(msg.activeIdx)
+		m.setConfigurations(msg.configurations)
+
+	case instances.AuthStateMsg:
+		m.authExpired[msg.ConfigName] = msg.Expired
+		if config := m.configuration(msg.ConfigName); config != nil {
+			config.AuthExpired = msg.Expired
+		}
+		return m, nil
+
+	case ProjectsResultMsg:
+		if msg.err != nil {
+			m.projectErrors[msg.configName] = msg.err
+		} else {
+			m.projects[msg.configName] = msg.projects
+		}
+		selectedItem := m.list.SelectedItem()
+		m.list.SetItems(m.items())
+		if c, ok := selectedItem.(*gcloud.Configuration); ok {
+			m.selectConfiguration(c.Name)
+			if m.restoreProject != "" && c.Name == msg.configName {
+				project := m.restoreProject
+				m.restoreProject = ""
+				if m.selectProject(c.Name, project) {
+					return m, m.selectionChanged(true)
+				}
+			}
+		}
+		return m, nil
+
+	case state.RestoreMsg:
+		if m.configuration(msg.UI.Configuration) == nil {
+			return m, nil
+		}
+		m.selectConfiguration(msg.UI.Configuration)
+		if msg.UI.Project == "" {
+			return m, nil
+		}
+		m.restoreProject = msg.UI.Project
+		return m, m.toggleProjects()
 
 	case ErrMsg:
 		m.error = msg.err
@@ -139,32 +448,64 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmds []tea.Cmd
 	newList, cmd := m.list.Update(msg)
 	cmds = append(cmds, cmd)
-	if newList.SelectedItem() != m.list.SelectedItem() {
+	changed := newList.SelectedItem() != m.list.SelectedItem()
+	m.list = newList
+	cmds = append(cmds, m.selectionChanged(changed))
+	return m, tea.Batch(cmds...)
+}
+
+// selectionChanged announces the highlighted configuration and project, and
+// reloads their instances when refresh is set.
+func (m *Model) selectionChanged(refresh bool) tea.Cmd {
+	selected := m.selected()
+	if selected == nil {
+		return nil
+	}
+	project := m.selectedProject()
+	cmds := []tea.Cmd{
+		func() tea.Msg {
+			return ConfigurationSelectedMsg{
+				Configuration: selected,
+				Project:       project,
+			}
+		},
+	}
+	if refresh {
 		cmds = append(cmds, func() tea.Msg {
 			return instances.RefreshMsg{
-				ConfigName: m.list.SelectedItem().(*gcloud.Configuration).Name,
+				ConfigName:     selected.Name,
+				Project:        project,
+				ServiceAccount: selected.ServiceAccount(),
 			}
 		})
 	}
-	m.list = newList
-	cmds = append(cmds, func() tea.Msg {
-		return ConfigurationSelectedMsg{
-			Configuration: m.list.SelectedItem().(*gcloud.Configuration),
-		}
-	})
-	return m, tea.Batch(cmds...)
+	return tea.Batch(cmds...)
 }
 
 func (m *Model) View() string {
 	style := views.PanelStyle.Width(m.size.Width - 2).Height(m.size.Height - 2)
-	selectedStyle := style.BorderForeground(lipgloss.Color("#5f5fd7"))
+	selectedStyle := style.BorderForeground(views.Colors.Border)
 
 	if m.focused {
 		style = selectedStyle
-		m.list.Styles.Title = m.list.Styles.Title.Background(lipgloss.Color("62"))
+		m.list.Styles.Title = m.list.Styles.Title.Background(views.Colors.Accent)
 	} else {
 		m.list.Styles.Title = m.list.Styles.Title.Background(lipgloss.NoColor{})
 	}
 
+	if m.form != nil {
+		return style.Render(m.form.View())
+	}
+
+	if m.picker != nil {
+		return style.Render(m.picker.View())
+	}
+
+	if m.error != nil {
+		return style.Align(lipgloss.Center, lipgloss.Center).Foreground(views.Colors.Error).Render(
+			fmt.Sprintf("Error fetching configurations\n%v", m.error.Error()),
+		)
+	}
+
 	return style.Render(m.list.View())
 }
@@ -0,0 +1,32 @@
+package configurations
+
+import (
+	"github.com/charmbracelet/bubbles/list"
+	"gssh/views"
+	"io"
+)
+
+// delegate renders the protected configurations and projects in the warning
+// colour, so that they stand out from the others.
+type delegate struct {
+	list.DefaultDelegate
+	protected list.DefaultDelegate
+}
+
+func newDelegate() delegate {
+	d := views.NewListDelegate()
+	p := views.NewListDelegate()
+	p.Styles.NormalTitle = p.Styles.NormalTitle.Foreground(views.Colors.Warning)
+	p.Styles.NormalDesc = p.Styles.NormalDesc.Foreground(views.Colors.Warning)
+	p.Styles.SelectedTitle = p.Styles.SelectedTitle.Bold(true).Foreground(views.Colors.Warning).BorderForeground(views.Colors.Warning)
+	p.Styles.SelectedDesc = p.Styles.SelectedDesc.Foreground(views.Colors.Warning).BorderForeground(views.Colors.Warning)
+	return delegate{DefaultDelegate: d, protected: p}
+}
+
+func (d delegate) Render(w io.Writer, m list.Model, index int, item list.Item) {
+	if p, ok := item.(interface{ Protected() bool }); ok && p.Protected() {
+		d.protected.Render(w, m, index, item)
+		return
+	}
+	d.DefaultDelegate.Render(w, m, index, item)
+}
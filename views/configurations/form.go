@@ -0,0 +1,226 @@
+package configurations
+
+import (
+	"errors"
+	"fmt"
+	"github.com/charmbracelet/bubbles/cursor"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"gssh/gcloud"
+	"gssh/views"
+	"strings"
+)
+
+type formKind int
+
+const (
+	formCreate formKind = iota
+	formClone
+	formRename
+	formDelete
+)
+
+const (
+	fieldName = iota
+	fieldAccount
+	fieldProject
+	fieldZone
+	fieldRegion
+)
+
+var fieldLabels = []string{"Name", "Account", "Project", "Zone", "Region"}
+
+type formDoneMsg struct{}
+type formErrMsg struct {
+	err error
+}
+
+type form struct {
+	kind   formKind
+	target *gcloud.Configuration
+	inputs []textinput.Model
+	focus  int
+	busy   bool
+	error  error
+}
+
+func newInput(label string, value string) textinput.Model {
+	input := textinput.New()
+	input.Prompt = fmt.Sprintf("%-8s ", label+":")
+	input.Cursor.SetMode(cursor.CursorStatic)
+	input.SetValue(value)
+	return input
+}
+
+func newCreateForm() *form {
+	f := &form{kind: formCreate}
+	for _, label := range fieldLabels {
+		f.inputs = append(f.inputs, newInput(label, ""))
+	}
+	f.inputs[fieldName].Focus()
+	return f
+}
+
+func newCloneForm(source *gcloud.Configuration) *form {
+	f := &form{kind: formClone, target: source}
+	values := []string{source.Name + "-copy", source.Account, source.Project, source.Zone, source.Region}
+	for i, label := range fieldLabels {
+		f.inputs = append(f.inputs, newInput(label, values[i]))
+	}
+	f.inputs[fieldName].Focus()
+	return f
+}
+
+func newRenameForm(target *gcloud.Configuration) *form {
+	f := &form{kind: formRename, target: target}
+	f.inputs = append(f.inputs, newInput("Name", target.Name))
+	f.inputs[fieldName].Focus()
+	return f
+}
+
+func newDeleteForm(target *gcloud.Configuration) *form {
+	return &form{kind: formDelete, target: target}
+}
+
+func (f *form) value(field int) string {
+	return strings.TrimSpace(f.inputs[field].Value())
+}
+
+func (f *form) setFocus(focus int) {
+	f.inputs[f.focus].Blur()
+	f.focus = (focus + len(f.inputs)) % len(f.inputs)
+	f.inputs[f.focus].Focus()
+}
+
+func (f *form) submit() tea.Cmd {
+	switch f.kind {
+	case formCreate, formClone:
+		name := f.value(fieldName)
+		props := gcloud.ConfigurationProperties{
+			Account: f.value(fieldAccount),
+			Project: f.value(fieldProject),
+			Zone:    f.value(fieldZone),
+			Region:  f.value(fieldRegion),
+		}
+		if name == "" {
+			f.error = errors.New("a configuration name is required")
+			return nil
+		}
+		f.busy = true
+		return func() tea.Msg {
+			if err := gcloud.CreateConfiguration(name, props); err != nil {
+				return formErrMsg{err}
+			}
+			return formDoneMsg{}
+		}
+
+	case formRename:
+		name := f.value(fieldName)
+		if name == "" || name == f.target.Name {
+			f.error = errors.New("enter a new name for the configuration")
+			return nil
+		}
+		if f.target.Active {
+			f.error = errors.New("the active configuration cannot be renamed")
+			return nil
+		}
+		f.busy = true
+		oldName := f.target.Name
+		return func() tea.Msg {
+			if err := gcloud.RenameConfiguration(oldName, name); err != nil {
+				return formErrMsg{err}
+			}
+			return formDoneMsg{}
+		}
+
+	case formDelete:
+		if f.target.Active {
+			f.error = errors.New("the active configuration cannot be deleted")
+			return nil
+		}
+		f.busy = true
+		name := f.target.Name
+		return func() tea.Msg {
+			if err := gcloud.DeleteConfiguration(name); err != nil {
+				return formErrMsg{err}
+			}
+			return formDoneMsg{}
+		}
+	}
+	return nil
+}
+
+// update handles a key press while the form is open. It returns false once
+// the form has been dismissed.
+func (f *form) update(msg tea.KeyMsg) (bool, tea.Cmd) {
+	if f.busy {
+		return true, nil
+	}
+
+	if f.kind == formDelete {
+		switch msg.String() {
+		case "y", "Y":
+			return true, f.submit()
+		case "n", "N", "esc":
+			return false, nil
+		}
+		return true, nil
+	}
+
+	switch msg.String() {
+	case "esc":
+		return false, nil
+	case "enter":
+		return true, f.submit()
+	case "tab", "down":
+		f.setFocus(f.focus + 1)
+		return true, nil
+	case "shift+tab", "up":
+		f.setFocus(f.focus - 1)
+		return true, nil
+	}
+
+	var cmd tea.Cmd
+	f.inputs[f.focus], cmd = f.inputs[f.focus].Update(msg)
+	return true, cmd
+}
+
+func (f *form) View() string {
+	var title string
+	switch f.kind {
+	case formCreate:
+		title = "New configuration"
+	case formClone:
+		title = fmt.Sprintf("Clone configuration [%v]", f.target.Name)
+	case formRename:
+		title = fmt.Sprintf("Rename configuration [%v]", f.target.Name)
+	case formDelete:
+		title = fmt.Sprintf("Delete configuration [%v]", f.target.Name)
+	}
+
+	lines := []string{
+		lipgloss.NewStyle().Bold(true).Background(views.Colors.Accent).Foreground(views.Colors.AccentText).Padding(0, 1).Render(title),
+		"",
+	}
+
+	if f.kind == formDelete {
+		lines = append(lines, "Are you sure? This cannot be undone. (y/N)")
+	} else {
+		for _, input := range f.inputs {
+			lines = append(lines, input.View())
+		}
+	}
+
+	lines = append(lines, "")
+	switch {
+	case f.busy:
+		lines = append(lines, lipgloss.NewStyle().Foreground(views.Colors.Info).Render("Running gcloud..."))
+	case f.error != nil:
+		lines = append(lines, lipgloss.NewStyle().Foreground(views.Colors.Error).Render(f.error.Error()))
+	case f.kind != formDelete:
+		lines = append(lines, lipgloss.NewStyle().Foreground(views.Colors.Muted).Render("↵ confirm • ⇥ next field • esc cancel"))
+	}
+
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
@@ -0,0 +1,108 @@
+package configurations
+
+import (
+	"fmt"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"gssh/gcloud"
+	"gssh/views"
+)
+
+type serviceAccountsMsg struct {
+	accounts []*gcloud.ServiceAccount
+	err      error
+}
+
+type pickedMsg struct {
+	serviceAccount string
+}
+
+type defaultIdentityItem struct {
+	account string
+}
+
+func (d defaultIdentityItem) Title() string       { return "(no impersonation)" }
+func (d defaultIdentityItem) Description() string { return d.account }
+func (d defaultIdentityItem) FilterValue() string { return "" }
+
+// picker lets the user choose the service account to impersonate for a
+// configuration.
+type picker struct {
+	target  *gcloud.Configuration
+	list    list.Model
+	loading bool
+	error   error
+}
+
+func newPicker(target *gcloud.Configuration, project string, width int, height int) (*picker, tea.Cmd) {
+	l := list.New([]list.Item{}, views.NewListDelegate(), width, height)
+	l.Title = fmt.Sprintf("Impersonate in [%v]", target.Name)
+	l.SetShowStatusBar(false)
+	l.SetShowHelp(false)
+	l.DisableQuitKeybindings()
+	l.SetFilteringEnabled(false)
+
+	p := &picker{
+		target:  target,
+		list:    l,
+		loading: true,
+	}
+	configName := target.Name
+	return p, func() tea.Msg {
+		accounts, err := gcloud.ListServiceAccounts(configName, project)
+		return serviceAccountsMsg{accounts, err}
+	}
+}
+
+func (p *picker) setAccounts(accounts []*gcloud.ServiceAccount) {
+	items := []list.Item{defaultIdentityItem{p.target.Account}}
+	current := 0
+	for _, account := range accounts {
+		if account.Email == p.target.ServiceAccount() {
+			current = len(items)
+		}
+		items = append(items, account)
+	}
+	p.list.SetItems(items)
+	p.list.Select(current)
+	p.loading = false
+}
+
+// update handles a key press while the picker is open. It returns false once
+// the picker has been dismissed.
+func (p *picker) update(msg tea.KeyMsg) (bool, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		return false, nil
+	case "enter":
+		if p.loading {
+			return true, nil
+		}
+		serviceAccount := ""
+		if account, ok := p.list.SelectedItem().(*gcloud.ServiceAccount); ok {
+			serviceAccount = account.Email
+		}
+		return false, func() tea.Msg {
+			return pickedMsg{serviceAccount}
+		}
+	}
+
+	var cmd tea.Cmd
+	p.list, cmd = p.list.Update(msg)
+	return true, cmd
+}
+
+func (p *picker) View() string {
+	switch {
+	case p.loading:
+		return lipgloss.NewStyle().Foreground(views.Colors.Info).Render(
+			fmt.Sprintf("Fetching service accounts for [%v]...", p.target.Name),
+		)
+	case p.error != nil:
+		return lipgloss.NewStyle().Foreground(views.Colors.Error).Render(
+			fmt.Sprintf("Error fetching service accounts\n%v\n\nPress esc to close", p.error.Error()),
+		)
+	}
+	return p.list.View()
+}
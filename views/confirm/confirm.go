@@ -0,0 +1,152 @@
+package confirm
+
+import (
+	"errors"
+	"fmt"
+	"github.com/charmbracelet/bubbles/cursor"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"gssh/views"
+	"strings"
+)
+
+var _ tea.Model = &Model{}
+
+// OpenMsg asks to confirm an action on a protected instance, by typing Name.
+type OpenMsg struct {
+	// Action is what is about to happen, e.g. "SSH to [prod] -> web-1".
+	Action string
+	Name   string
+}
+
+// ConfirmedMsg goes ahead with the action, for Reason.
+type ConfirmedMsg struct {
+	Reason string
+}
+type ClosedMsg struct{}
+
+const (
+	fieldName = iota
+	fieldReason
+)
+
+// Model is the full-screen confirmation of an action on a protected
+// instance, with an optional reason kept in the history and audit log.
+type Model struct {
+	width  int
+	height int
+	action string
+	name   string
+
+	inputs []textinput.Model
+	focus  int
+	error  error
+}
+
+func InitialModel() *Model {
+	return &Model{}
+}
+
+func (m *Model) Init() tea.Cmd {
+	return nil
+}
+
+func newInput(label string, placeholder string) textinput.Model {
+	input := textinput.New()
+	input.Prompt = fmt.Sprintf("%-8s ", label+":")
+	input.Placeholder = placeholder
+	input.Cursor.SetMode(cursor.CursorStatic)
+	return input
+}
+
+func (m *Model) setFocus(focus int) {
+	m.inputs[m.focus].Blur()
+	m.focus = (focus + len(m.inputs)) % len(m.inputs)
+	m.inputs[m.focus].Focus()
+}
+
+func (m *Model) submit() tea.Cmd {
+	if strings.TrimSpace(m.inputs[fieldName].Value()) != m.name {
+		m.error = errors.New("the name does not match")
+		m.setFocus(fieldName)
+		return nil
+	}
+	if m.focus == fieldName {
+		m.setFocus(fieldReason)
+		return nil
+	}
+	reason := strings.TrimSpace(m.inputs[fieldReason].Value())
+	return func() tea.Msg {
+		return ConfirmedMsg{Reason: reason}
+	}
+}
+
+func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+
+	case OpenMsg:
+		m.action = msg.Action
+		m.name = msg.Name
+		m.inputs = []textinput.Model{
+			newInput("Name", msg.Name),
+			newInput("Reason", "optional, e.g. the ticket being worked on"),
+		}
+		m.focus = fieldName
+		m.error = nil
+		m.inputs[m.focus].Focus()
+
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "esc":
+			return m, func() tea.Msg {
+				return ClosedMsg{}
+			}
+		case "enter":
+			return m, m.submit()
+		case "tab", "down":
+			m.setFocus(m.focus + 1)
+		case "shift+tab", "up":
+			m.setFocus(m.focus - 1)
+		default:
+			m.error = nil
+			var cmd tea.Cmd
+			m.inputs[m.focus], cmd = m.inputs[m.focus].Update(msg)
+			return m, cmd
+		}
+	}
+	return m, nil
+}
+
+func (m *Model) View() string {
+	if m.inputs == nil {
+		return ""
+	}
+	width := min(m.width-4, 100)
+
+	lines := []string{
+		lipgloss.NewStyle().Bold(true).Background(views.Colors.Warning).Foreground(views.Colors.WarningText).Padding(0, 1).Render("🛡️ Protected instance"),
+		"",
+		"You are about to " + lipgloss.NewStyle().Bold(true).Foreground(views.Colors.Warning).Render(m.action) + ".",
+		"Type " + lipgloss.NewStyle().Foreground(views.Colors.Highlight).Render(m.name) + " to confirm.",
+		"",
+	}
+	for _, input := range m.inputs {
+		lines = append(lines, input.View())
+	}
+	lines = append(lines, "")
+	if m.error != nil {
+		lines = append(lines, lipgloss.NewStyle().Foreground(views.Colors.Error).Render(m.error.Error()))
+	} else {
+		lines = append(lines, lipgloss.NewStyle().Foreground(views.Colors.Muted).Render("↵ confirm • ⇥ next field • esc cancel"))
+	}
+
+	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center,
+		views.PanelStyle.BorderForeground(views.Colors.Warning).Width(width).Render(
+			lipgloss.JoinVertical(lipgloss.Left, lines...),
+		),
+	)
+}
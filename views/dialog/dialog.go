@@ -0,0 +1,242 @@
+package dialog
+
+import (
+	"errors"
+	"fmt"
+	"github.com/charmbracelet/bubbles/cursor"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"gssh/config"
+	"gssh/sshclient"
+	"gssh/views"
+	"strings"
+)
+
+var _ tea.Model = &Model{}
+
+// OpenMsg shows the error of a failed connection.
+type OpenMsg struct {
+	Title   string
+	Err     error
+	Options sshclient.Options
+	// FixedOptions hides the options form, for connections without SSH
+	// options such as the serial port.
+	FixedOptions bool
+}
+
+// RetryMsg connects again, with Options.
+type RetryMsg struct {
+	Options sshclient.Options
+}
+type ClosedMsg struct{}
+
+const (
+	fieldUser = iota
+	fieldClient
+	fieldIAP
+)
+
+var fieldLabels = []string{"User", "Client", "IAP"}
+
+// Model is the full-screen dialog shown when a connection fails, offering to
+// retry it as is or with different options.
+type Model struct {
+	width   int
+	height  int
+	title   string
+	err     error
+	options sshclient.Options
+	fixed   bool
+
+	// inputs edit the options, when set.
+	inputs    []textinput.Model
+	focus     int
+	formError error
+}
+
+func InitialModel() *Model {
+	return &Model{}
+}
+
+func (m *Model) Init() tea.Cmd {
+	return nil
+}
+
+func newInput(label string, value string, placeholder string) textinput.Model {
+	input := textinput.New()
+	input.Prompt = fmt.Sprintf("%-7s ", label+":")
+	input.Placeholder = placeholder
+	input.Cursor.SetMode(cursor.CursorStatic)
+	input.SetValue(value)
+	return input
+}
+
+func (m *Model) editOptions() {
+	client := m.options.Client
+	if client == "" {
+		client = "gcloud"
+		if m.options.Native() {
+			client = "native"
+		}
+	}
+	iap := "no"
+	if m.options.IAP {
+		iap = "yes"
+	}
+	m.inputs = []textinput.Model{
+		newInput(fieldLabels[fieldUser], m.options.UserName, config.Config.SSH.UserName),
+		newInput(fieldLabels[fieldClient], client, "gcloud or native"),
+		newInput(fieldLabels[fieldIAP], iap, "yes or no"),
+	}
+	m.focus = fieldUser
+	m.formError = nil
+	m.inputs[m.focus].Focus()
+}
+
+func (m *Model) setFocus(focus int) {
+	m.inputs[m.focus].Blur()
+	m.focus = (focus + len(m.inputs)) % len(m.inputs)
+	m.inputs[m.focus].Focus()
+}
+
+func (m *Model) value(field int) string {
+	return strings.TrimSpace(m.inputs[field].Value())
+}
+
+func (m *Model) submit() tea.Cmd {
+	opts := sshclient.Options{UserName: m.value(fieldUser)}
+	switch client := m.value(fieldClient); client {
+	case "gcloud", "native":
+		opts.Client = client
+	default:
+		m.formError = errors.New("the client is either gcloud or native")
+		return nil
+	}
+	switch strings.ToLower(m.value(fieldIAP)) {
+	case "yes", "y":
+		opts.IAP = true
+	case "no", "n", "":
+	default:
+		m.formError = errors.New("IAP is either yes or no")
+		return nil
+	}
+	return retry(opts)
+}
+
+func retry(opts sshclient.Options) tea.Cmd {
+	return tea.Batch(closed, func() tea.Msg {
+		return RetryMsg{Options: opts}
+	})
+}
+
+func closed() tea.Msg {
+	return ClosedMsg{}
+}
+
+func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+
+	case OpenMsg:
+		m.title = msg.Title
+		m.err = msg.Err
+		m.options = msg.Options
+		m.fixed = msg.FixedOptions
+		m.inputs = nil
+
+	case tea.KeyMsg:
+		if m.inputs != nil {
+			switch msg.String() {
+			case "esc":
+				m.inputs = nil
+			case "enter":
+				return m, m.submit()
+			case "tab", "down":
+				m.setFocus(m.focus + 1)
+			case "shift+tab", "up":
+				m.setFocus(m.focus - 1)
+			default:
+				var cmd tea.Cmd
+				m.inputs[m.focus], cmd = m.inputs[m.focus].Update(msg)
+				return m, cmd
+			}
+			return m, nil
+		}
+
+		keys := views.Keys
+		switch {
+		case key.Matches(msg, keys.Reload, keys.Select):
+			return m, retry(m.options)
+		case key.Matches(msg, keys.OpenConsole):
+			if !m.fixed {
+				m.editOptions()
+			}
+		case msg.String() == "esc" || key.Matches(msg, keys.Quit):
+			return m, closed
+		}
+	}
+	return m, nil
+}
+
+// errorLines is the error as printed to the terminal, without its escape
+// sequences, keeping the last lines that fit.
+func (m *Model) errorLines(width int, height int) []string {
+	text := strings.ReplaceAll(ansi.Strip(m.err.Error()), "\r", "")
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		lines = append(lines, ansi.Truncate(line, width, "…"))
+	}
+	if len(lines) > height {
+		lines = append([]string{"…"}, lines[len(lines)-height+1:]...)
+	}
+	return lines
+}
+
+func (m *Model) View() string {
+	width := min(m.width-4, 100)
+	frame, _ := views.PanelStyle.GetFrameSize()
+
+	lines := []string{
+		lipgloss.NewStyle().Bold(true).Background(views.Colors.Error).Foreground(views.Colors.AccentText).Padding(0, 1).Render(m.title),
+		"",
+	}
+	var footer string
+	if m.inputs != nil {
+		lines = append(lines, "Connect with different options:", "")
+		for _, input := range m.inputs {
+			lines = append(lines, input.View())
+		}
+		lines = append(lines, "")
+		if m.formError != nil {
+			lines = append(lines, lipgloss.NewStyle().Foreground(views.Colors.Error).Render(m.formError.Error()))
+		} else {
+			lines = append(lines, lipgloss.NewStyle().Foreground(views.Colors.Muted).Render("↵ connect • ⇥ next field • esc back"))
+		}
+	} else {
+		for _, line := range m.errorLines(width-frame, max(m.height-14, 1)) {
+			lines = append(lines, lipgloss.NewStyle().Foreground(views.Colors.ErrorDetail).Render(line))
+		}
+		var hints []string
+		for _, b := range views.Keys.DialogGroup(!m.fixed).Short {
+			if b.Enabled() {
+				hints = append(hints, b.Help().Key+" "+b.Help().Desc)
+			}
+		}
+		footer = strings.Join(hints, " • ")
+	}
+
+	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center,
+		lipgloss.JoinVertical(lipgloss.Center,
+			views.PanelStyle.BorderForeground(views.Colors.Error).Width(width).Render(
+				lipgloss.JoinVertical(lipgloss.Left, lines...),
+			),
+			"",
+			lipgloss.NewStyle().Foreground(views.Colors.Muted).Render(footer),
+		),
+	)
+}
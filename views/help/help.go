@@ -0,0 +1,111 @@
+package help
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"gssh/views"
+)
+
+var _ tea.Model = &Model{}
+
+type SetActivePanelMsg struct {
+	ActivePanel views.ActivePanel
+}
+
+// Model is the full-screen overlay listing every key binding, grouped per
+// panel, with the active panel first.
+type Model struct {
+	width       int
+	height      int
+	activePanel views.ActivePanel
+}
+
+func InitialModel() *Model {
+	return &Model{
+		activePanel: views.Configurations,
+	}
+}
+
+func (m *Model) Init() tea.Cmd {
+	return nil
+}
+
+func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+	case SetActivePanelMsg:
+		m.activePanel = msg.ActivePanel
+	}
+	return m, nil
+}
+
+func renderGroup(group views.KeyGroup, active bool) string {
+	titleStyle := lipgloss.NewStyle().Bold(true).Padding(0, 1)
+	if active {
+		titleStyle = titleStyle.Background(views.Colors.Accent).Foreground(views.Colors.AccentText)
+	} else {
+		titleStyle = titleStyle.Foreground(views.Colors.Highlight)
+	}
+
+	keyWidth := 0
+	for _, b := range group.Full {
+		keyWidth = max(keyWidth, lipgloss.Width(b.Help().Key))
+	}
+
+	lines := []string{titleStyle.Render(group.Title), ""}
+	for _, b := range group.Full {
+		if !b.Enabled() {
+			continue
+		}
+		lines = append(lines, lipgloss.JoinHorizontal(0,
+			lipgloss.NewStyle().Width(keyWidth+2).Foreground(views.Colors.Info).Render(b.Help().Key),
+			lipgloss.NewStyle().Foreground(views.Colors.Muted).Render(b.Help().Desc),
+		))
+	}
+	return lipgloss.NewStyle().Padding(0, 2).Render(lipgloss.JoinVertical(lipgloss.Left, lines...))
+}
+
+func (m *Model) View() string {
+	keys := views.Keys
+
+	panels := []views.ActivePanel{views.Configurations, views.Instances, views.History}
+	groups := []string{renderGroup(keys.PanelGroup(m.activePanel), true)}
+	for _, panel := range panels {
+		if panel != m.activePanel {
+			groups = append(groups, renderGroup(keys.PanelGroup(panel), false))
+		}
+	}
+	groups = append(groups, renderGroup(keys.SerialOutputGroup(), false))
+	groups = append(groups, renderGroup(keys.PlayerGroup(), false))
+	groups = append(groups, renderGroup(keys.DialogGroup(true), false))
+	groups = append(groups, renderGroup(keys.GlobalGroup(), false))
+
+	// Wrap the groups so that the overlay fits narrow terminals.
+	frame, _ := views.PanelStyle.GetFrameSize()
+	var rows []string
+	var row []string
+	for _, group := range groups {
+		if len(row) > 0 && lipgloss.Width(lipgloss.JoinHorizontal(lipgloss.Top, append(row, group)...))+frame > m.width {
+			rows = append(rows, lipgloss.JoinHorizontal(lipgloss.Top, row...), "")
+			row = nil
+		}
+		row = append(row, group)
+	}
+	rows = append(rows, lipgloss.JoinHorizontal(lipgloss.Top, row...))
+
+	footer := lipgloss.NewStyle().Foreground(views.Colors.Muted).Render(
+		"Press " + keys.Help.Help().Key + " or esc to close",
+	)
+
+	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center,
+		lipgloss.JoinVertical(lipgloss.Center,
+			views.PanelStyle.BorderForeground(views.Colors.Border).Render(
+				lipgloss.JoinVertical(lipgloss.Left, rows...),
+			),
+			"",
+			footer,
+		),
+	)
+}
@@ -1,12 +1,19 @@
 package history
 
 import (
+	"fmt"
+	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	bl "github.com/winder/bubblelayout"
 	"gssh/history"
 	"gssh/views"
+	"gssh/views/clipboard"
+	"gssh/views/palette"
+	"gssh/views/player"
+	"gssh/views/serial"
+	"gssh/views/statusbar"
 	"time"
 )
 
@@ -52,8 +59,9 @@ func RefreshHistory() tea.Msg {
 }
 
 func InitialModel() *Model {
-	l := list.New([]list.Item{}, list.NewDefaultDelegate(), 0, 0)
+	l := list.New([]list.Item{}, views.NewListDelegate(), 0, 0)
 	l.SetShowHelp(false)
+	l.DisableQuitKeybindings()
 	l.SetShowStatusBar(false)
 	l.SetShowFilter(false)
 	l.Styles.Title = l.Styles.Title.Background(lipgloss.NoColor{}).Padding(0, 0)
@@ -63,6 +71,42 @@ func InitialModel() *Model {
 	}
 }
 
+func (m *Model) Commands() []palette.Command {
+	commands := make([]palette.Command, 0, len(m.connections))
+	seen := map[string]bool{}
+	for _, c := range m.connections {
+		id := c.ConfigName + "/" + c.Instance.Name
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		commands = append(commands, palette.Command{
+			Title: "Reconnect to " + c.Instance.Name,
+			Hint:  c.ConfigName,
+			Msg:   ConnectionSelectedMsg{c},
+		})
+	}
+	for _, c := range m.connections {
+		if c.Recording != "" {
+			commands = append(commands, palette.Command{
+				Title: "Play recording of " + c.Instance.Name,
+				Hint:  c.Timestamp.Format("02/01/2006 15:04:05"),
+				Msg:   player.OpenMsg{File: c.Recording, Title: fmt.Sprintf("[%v] %v", c.ConfigName, c.Instance.Name)},
+			})
+		}
+	}
+	return commands
+}
+
+func play(c *history.Connection) tea.Cmd {
+	return func() tea.Msg {
+		if c.Recording == "" {
+			return statusbar.NoticeMsg{Text: "This session was not recorded"}
+		}
+		return player.OpenMsg{File: c.Recording, Title: fmt.Sprintf("[%v] %v", c.ConfigName, c.Instance.Name)}
+	}
+}
+
 func (m *Model) Init() tea.Cmd {
 	go func() {
 		m.Update(RefreshHistory())
@@ -107,8 +151,48 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 
 	case tea.KeyMsg:
-		switch msg.String() {
-		case "enter":
+		switch {
+		case key.Matches(msg, views.Keys.OpenConsole):
+			if c, ok := m.list.SelectedItem().(*history.Connection); ok {
+				return m, func() tea.Msg {
+					return views.OpenConsoleMsg{Instance: c.Instance, ConfigName: c.ConfigName, ServiceAccount: c.ServiceAccount}
+				}
+			}
+			return m, nil
+
+		case key.Matches(msg, views.Keys.SerialPort):
+			if c, ok := m.list.SelectedItem().(*history.Connection); ok {
+				return m, func() tea.Msg {
+					return views.SerialPortMsg{Instance: c.Instance, ConfigName: c.ConfigName, ServiceAccount: c.ServiceAccount}
+				}
+			}
+			return m, nil
+
+		case key.Matches(msg, views.Keys.SerialOutput):
+			if c, ok := m.list.SelectedItem().(*history.Connection); ok {
+				return m, func() tea.Msg {
+					return serial.OpenMsg{Instance: c.Instance, ConfigName: c.ConfigName, ServiceAccount: c.ServiceAccount}
+				}
+			}
+			return m, nil
+
+		case key.Matches(msg, views.Keys.Play):
+			c, ok := m.list.SelectedItem().(*history.Connection)
+			if !ok {
+				return m, nil
+			}
+			return m, play(c)
+
+		case key.Matches(msg, views.Keys.Copy):
+			c, ok := m.list.SelectedItem().(*history.Connection)
+			if !ok {
+				return m, nil
+			}
+			commands := clipboard.Commands(c.Instance, c.ConfigName, c.ServiceAccount)
+			return m, func() tea.Msg {
+				return palette.OpenMsg{Commands: commands}
+			}
+		case key.Matches(msg, views.Keys.Select):
 			c, ok := m.list.SelectedItem().(*history.Connection)
 			if !ok {
 				return m, nil
@@ -119,6 +203,28 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		}
 
+	case views.ClickMsg:
+		index := views.ListItemAt(m.list, msg.Y)
+		if index < 0 {
+			return m, nil
+		}
+		m.list.Select(index)
+		c, ok := m.list.SelectedItem().(*history.Connection)
+		if !msg.Double || !ok {
+			return m, nil
+		}
+		return m, func() tea.Msg {
+			return ConnectionSelectedMsg{c}
+		}
+
+	case views.WheelMsg:
+		if msg.Down {
+			m.list.CursorDown()
+		} else {
+			m.list.CursorUp()
+		}
+		return m, nil
+
 	case bl.Size:
 		x, y := views.PanelStyle.GetFrameSize()
 		m.size = msg
@@ -137,16 +243,16 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 func (m *Model) View() string {
 	style := views.PanelStyle.Width(m.size.Width - 2).Height(m.size.Height - 2)
-	selectedStyle := style.BorderForeground(lipgloss.Color("#5f5fd7"))
+	selectedStyle := style.BorderForeground(views.Colors.Border)
 
-	configStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#ee6ff8"))
+	configStyle := lipgloss.NewStyle().Foreground(views.Colors.Highlight)
 
 	titleStyle := lipgloss.NewStyle()
 
 	if m.focused {
 		style = selectedStyle
-		titleStyle = titleStyle.Background(lipgloss.Color("62"))
-		configStyle = configStyle.Background(lipgloss.Color("62"))
+		titleStyle = titleStyle.Background(views.Colors.Accent)
+		configStyle = configStyle.Background(views.Colors.Accent)
 	} else {
 		titleStyle = titleStyle.Background(lipgloss.NoColor{})
 		configStyle = configStyle.Background(lipgloss.NoColor{})
@@ -154,13 +260,13 @@ func (m *Model) View() string {
 
 	m.list.Title = lipgloss.JoinHorizontal(0,
 		lipgloss.JoinHorizontal(0,
-			titleStyle.Foreground(lipgloss.Color("#ffffff")).Render(" Connection history "),
+			titleStyle.Foreground(views.Colors.AccentText).Render(" Connection history "),
 			titleStyle.Render(" "),
 		),
 	)
 
 	if m.error != nil {
-		return style.Align(lipgloss.Center, lipgloss.Center).Foreground(lipgloss.Color("202")).Render(
+		return style.Align(lipgloss.Center, lipgloss.Center).Foreground(views.Colors.Error).Render(
 			"Error getting history",
 		)
 	}
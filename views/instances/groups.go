@@ -0,0 +1,101 @@
+package instances
+
+import (
+	"fmt"
+	"gssh/config"
+	"gssh/gcloud"
+	"log"
+	"path"
+	"sort"
+	"strings"
+)
+
+type grouping struct {
+	name string
+	key  func(i *gcloud.Instance) string
+}
+
+var groupings []grouping
+
+func init() {
+	groupings = []grouping{
+		{name: ""},
+		{name: "zone", key: func(i *gcloud.Instance) string { return path.Base(i.Zone) }},
+		{name: "region", key: func(i *gcloud.Instance) string { return i.Region() }},
+		{name: "instance_group", key: func(i *gcloud.Instance) string {
+			if i.InstanceGroup == "" {
+				return "(no instance group)"
+			}
+			return i.InstanceGroup
+		}},
+	}
+	for _, label := range config.Config.Instances.GroupLabels {
+		groupings = append(groupings, labelGrouping(label))
+	}
+
+	// A label grouping may be configured as default without being listed in
+	// group_labels.
+	groupBy := config.Config.Instances.GroupBy
+	if label, ok := strings.CutPrefix(groupBy, "label:"); ok && findGrouping(groupBy) < 0 {
+		groupings = append(groupings, labelGrouping(label))
+	}
+	if findGrouping(groupBy) < 0 {
+		log.Fatal("Error in [instances] config: unknown group_by ", groupBy)
+	}
+}
+
+func labelGrouping(label string) grouping {
+	return grouping{name: "label:" + label, key: func(i *gcloud.Instance) string {
+		if v, ok := i.Labels[label]; ok {
+			return label + "=" + v
+		}
+		return fmt.Sprintf("(no %v label)", label)
+	}}
+}
+
+func findGrouping(name string) int {
+	for i, g := range groupings {
+		if g.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// groupItem is the header of a group of instances, in both the list and the
+// table layouts.
+type groupItem struct {
+	key       string
+	count     int
+	summary   string
+	collapsed bool
+}
+
+func (g *groupItem) Title() string {
+	arrow := "▾"
+	if g.collapsed {
+		arrow = "▸"
+	}
+	return fmt.Sprintf("%v %v (%d)", arrow, g.key, g.count)
+}
+func (g *groupItem) Description() string { return g.summary }
+func (g *groupItem) FilterValue() string { return "" }
+
+// statusSummary counts the instances of every status, e.g. "3 running, 1
+// terminated".
+func statusSummary(instances []*gcloud.Instance) string {
+	counts := map[gcloud.InstanceStatus]int{}
+	for _, inst := range instances {
+		counts[inst.Status]++
+	}
+	statuses := make([]string, 0, len(counts))
+	for status := range counts {
+		statuses = append(statuses, string(status))
+	}
+	sort.Strings(statuses)
+	parts := make([]string, 0, len(statuses))
+	for _, status := range statuses {
+		parts = append(parts, fmt.Sprintf("%d %v", counts[gcloud.InstanceStatus(status)], strings.ToLower(status)))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -2,12 +2,19 @@ package instances
 
 import (
 	"fmt"
+	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	bl "github.com/winder/bubblelayout"
+	"gssh/config"
 	"gssh/gcloud"
+	"gssh/state"
 	"gssh/views"
+	"gssh/views/clipboard"
+	"gssh/views/palette"
+	"gssh/views/serial"
+	"sort"
 	"time"
 )
 
@@ -16,57 +23,87 @@ var _ tea.Model = &Model{}
 type FocusMsg struct{}
 type BlurMsg struct{}
 type RefreshMsg struct {
-	ConfigName string
-	ClearCache bool
+	ConfigName     string
+	Project        string
+	ServiceAccount string
+	ClearCache     bool
+	// Protected shows the configuration or project is protected.
+	Protected bool
 }
 type FilteringStateMsg struct {
 	Filtering bool
 }
 
+type AuthStateMsg struct {
+	ConfigName string
+	Expired    bool
+}
+
 type ErrMsg struct {
-	err error
+	configName string
+	err        error
 }
 type ResultMsg struct {
-	instances []*gcloud.Instance
-	items     []list.Item
-	timestamp time.Time
+	configName string
+	instances  []*gcloud.Instance
+	items      []list.Item
+	timestamp  time.Time
 }
 type InstanceSelectedMsg struct {
 	Instance *gcloud.Instance
 }
 
 type Model struct {
-	focused bool
-	size    bl.Size
-	loading bool
-	error   error
+	focused     bool
+	size        bl.Size
+	loading     bool
+	error       error
+	authExpired bool
 
 	configName       string
+	project          string
+	serviceAccount   string
+	protected        bool
 	list             list.Model
+	table            *instanceTable
+	tableMode        bool
 	instances        []*gcloud.Instance
+	running          []*gcloud.Instance
+	grouping         int
+	collapsed        map[string]bool
 	lastUpdate       time.Time
 	selectedInstance *gcloud.Instance
+	// restoreFilter and restoreInstance are applied once the instances are
+	// listed.
+	restoreFilter   string
+	restoreInstance string
 }
 
 func InitialModel() *Model {
-	l := list.New([]list.Item{}, list.NewDefaultDelegate(), 0, 0)
+	l := list.New([]list.Item{}, views.NewListDelegate(), 0, 0)
 	l.SetShowHelp(false)
+	l.DisableQuitKeybindings()
 	l.SetShowStatusBar(false)
 	l.SetShowFilter(true)
 	l.Styles.Title = l.Styles.Title.Background(lipgloss.NoColor{}).Padding(0, 0)
 	l.FilterInput.Prompt = "🔍 "
 	l.FilterInput.Placeholder = "Filter instances..."
+	l.KeyMap.Filter = views.Keys.Filter
 
 	return &Model{
-		list:    l,
-		loading: true,
+		list:      l,
+		table:     newInstanceTable(),
+		tableMode: config.Config.Instances.View == "table",
+		loading:   true,
+		grouping:  findGrouping(config.Config.Instances.GroupBy),
+		collapsed: map[string]bool{},
 	}
 }
 
-func RefreshInstances(configName string, clearCache bool) tea.Msg {
-	instances, lastUpdate, err := gcloud.ListInstances(configName, clearCache)
+func RefreshInstances(configName string, project string, serviceAccount string, clearCache bool) tea.Msg {
+	instances, lastUpdate, err := gcloud.ListInstances(configName, project, serviceAccount, clearCache)
 	if err != nil {
-		return ErrMsg{err}
+		return ErrMsg{configName, err}
 	}
 
 	items := make([]list.Item, 0)
@@ -75,7 +112,25 @@ func RefreshInstances(configName string, clearCache bool) tea.Msg {
 			items = append(items, inst)
 		}
 	}
-	return ResultMsg{instances, items, *lastUpdate}
+	return ResultMsg{configName, instances, items, *lastUpdate}
+}
+
+func authState(configName string, expired bool) tea.Cmd {
+	return func() tea.Msg {
+		return AuthStateMsg{ConfigName: configName, Expired: expired}
+	}
+}
+
+func (m *Model) Commands() []palette.Command {
+	commands := make([]palette.Command, 0, len(m.running))
+	for _, inst := range m.running {
+		commands = append(commands, palette.Command{
+			Title: "Connect to " + inst.Name,
+			Hint:  inst.Description(),
+			Msg:   InstanceSelectedMsg{inst},
+		})
+	}
+	return commands
 }
 
 func (m *Model) Init() tea.Cmd {
@@ -91,78 +146,397 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case BlurMsg:
 		m.focused = false
 
+	case state.RestoreMsg:
+		m.restoreFilter = msg.UI.InstanceFilter
+		m.restoreInstance = msg.UI.Instance
+		return m, nil
+
 	case RefreshMsg:
+		// Polling would only hit the same authentication failure again.
+		if m.authExpired && !msg.ClearCache && msg.ConfigName == m.configName {
+			return m, nil
+		}
 		m.loading = msg.ClearCache
 		m.configName = msg.ConfigName
+		m.project = msg.Project
+		m.serviceAccount = msg.ServiceAccount
+		m.protected = msg.Protected
 		return m, func() tea.Msg {
-			return RefreshInstances(msg.ConfigName, msg.ClearCache)
+			return RefreshInstances(msg.ConfigName, msg.Project, msg.ServiceAccount, msg.ClearCache)
 		}
 
 	case ErrMsg:
 		m.loading = false
 		m.error = msg.err
+		m.authExpired = gcloud.IsAuthError(msg.err)
+		return m, authState(msg.configName, m.authExpired)
 
 	case ResultMsg:
 		m.instances = msg.instances
 		m.lastUpdate = msg.timestamp
 		m.loading = false
 		m.error = nil
-		m.list.SetItems(msg.items)
+		m.running = make([]*gcloud.Instance, 0, len(msg.items))
+		for _, item := range msg.items {
+			m.running = append(m.running, item.(*gcloud.Instance))
+		}
+		cmds = append(cmds, m.list.SetItems(m.items()))
+		if m.restoreFilter != "" {
+			cmds = append(cmds, m.applyFilter(m.restoreFilter))
+			m.restoreFilter = ""
+			// Groups are expanded under the filter.
+			cmds = append(cmds, m.list.SetItems(m.items()))
+		}
+		if m.authExpired {
+			m.authExpired = false
+			cmds = append(cmds, authState(msg.configName, false))
+		}
 
 	case tea.KeyMsg:
-		switch msg.String() {
-		case "enter":
-			i, ok := m.list.SelectedItem().(*gcloud.Instance)
-			if ok {
-				m.selectedInstance = i
+		filtering := m.list.FilterState() == list.Filtering
+		switch {
+		case key.Matches(msg, views.Keys.ToggleTable) && !filtering:
+			m.tableMode = !m.tableMode
+			m.syncTable()
+			return m, nil
+
+		case key.Matches(msg, views.Keys.SortTable) && m.tableMode && !filtering:
+			m.table.cycleSort()
+			m.syncTable()
+			return m, nil
+
+		case key.Matches(msg, views.Keys.ReverseSort) && m.tableMode && !filtering:
+			m.table.reverseSort()
+			m.syncTable()
+			return m, nil
+
+		case key.Matches(msg, views.Keys.GroupBy) && !filtering:
+			m.grouping = (m.grouping + 1) % len(groupings)
+			m.collapsed = map[string]bool{}
+			cmd := m.list.SetItems(m.items())
+			m.list.ResetSelected()
+			m.syncTable()
+			return m, cmd
+
+		case key.Matches(msg, views.Keys.Expand) && !filtering:
+			return m, m.toggleGroup()
+
+		case key.Matches(msg, views.Keys.OpenConsole) && !filtering:
+			if inst := m.highlighted(); inst != nil {
+				configName, serviceAccount := m.configName, m.serviceAccount
+				return m, func() tea.Msg {
+					return views.OpenConsoleMsg{Instance: inst, ConfigName: configName, ServiceAccount: serviceAccount}
+				}
 			}
+			return m, nil
 
+		case key.Matches(msg, views.Keys.SerialPort) && !filtering:
+			if inst := m.highlighted(); inst != nil {
+				configName, serviceAccount := m.configName, m.serviceAccount
+				return m, func() tea.Msg {
+					return views.SerialPortMsg{Instance: inst, ConfigName: configName, ServiceAccount: serviceAccount}
+				}
+			}
+			return m, nil
+
+		case key.Matches(msg, views.Keys.SerialOutput) && !filtering:
+			if inst := m.highlighted(); inst != nil {
+				configName, serviceAccount := m.configName, m.serviceAccount
+				return m, func() tea.Msg {
+					return serial.OpenMsg{Instance: inst, ConfigName: configName, ServiceAccount: serviceAccount}
+				}
+			}
+			return m, nil
+
+		case key.Matches(msg, views.Keys.Copy) && !filtering:
+			inst := m.highlighted()
+			if inst == nil {
+				return m, nil
+			}
+			commands := clipboard.Commands(inst, m.configName, m.serviceAccount)
+			return m, func() tea.Msg {
+				return palette.OpenMsg{Commands: commands}
+			}
+
+		case key.Matches(msg, views.Keys.Select):
+			selected := m.list.SelectedItem()
+			if m.tableMode && !filtering {
+				selected = m.table.selectedItem()
+			}
+			if _, ok := selected.(*groupItem); ok && !filtering {
+				return m, m.toggleGroup()
+			}
 			if m.list.FilterState() != list.Filtering {
+				i, ok := selected.(*gcloud.Instance)
+				if !ok {
+					return m, nil
+				}
+				m.selectedInstance = i
 				return m, func() tea.Msg {
-					return InstanceSelectedMsg{m.selectedInstance}
+					return InstanceSelectedMsg{i}
 				}
 			}
-		case "esc":
+		case msg.String() == "esc":
 			if m.list.FilterState() != list.Filtering {
 				return m, nil
 			}
 			cmds = append(cmds, func() tea.Msg {
 				return FilteringStateMsg{Filtering: false}
 			})
+
+		case m.tableMode && !filtering && !key.Matches(msg, views.Keys.Filter):
+			var cmd tea.Cmd
+			m.table.table, cmd = m.table.table.Update(msg)
+			return m, cmd
 		}
 
+	case views.ClickMsg:
+		if m.list.FilterState() == list.Filtering {
+			return m, nil
+		}
+		var selected list.Item
+		if m.tableMode {
+			// Below the list title.
+			row := m.table.rowAt(msg.Y - views.PanelStyle.GetBorderTopSize() - views.PanelStyle.GetPaddingTop() - 2)
+			if row < 0 {
+				return m, nil
+			}
+			m.table.table.SetCursor(row)
+			selected = m.table.selectedItem()
+		} else {
+			index := views.ListItemAt(m.list, msg.Y)
+			if index < 0 {
+				return m, nil
+			}
+			m.list.Select(index)
+			selected = m.list.SelectedItem()
+		}
+		if !msg.Double {
+			return m, nil
+		}
+		switch item := selected.(type) {
+		case *groupItem:
+			return m, m.toggleGroup()
+		case *gcloud.Instance:
+			m.selectedInstance = item
+			return m, func() tea.Msg {
+				return InstanceSelectedMsg{item}
+			}
+		}
+		return m, nil
+
+	case views.WheelMsg:
+		switch {
+		case m.tableMode && msg.Down:
+			m.table.table.MoveDown(1)
+		case m.tableMode:
+			m.table.table.MoveUp(1)
+		case msg.Down:
+			m.list.CursorDown()
+		default:
+			m.list.CursorUp()
+		}
+		return m, nil
+
 	case bl.Size:
 		x, y := views.PanelStyle.GetFrameSize()
 		m.size = msg
 		m.list.SetSize(msg.Width-x-2, msg.Height-y-2)
+		m.table.setSize(msg.Width-x-2, msg.Height-y-6)
 	}
 
+	filterState := m.list.FilterState()
 	var cmd tea.Cmd
 	m.list, cmd = m.list.Update(msg)
 	cmds = append(cmds, cmd)
+	// Collapsed groups are expanded while a filter applies.
+	if filterState != m.list.FilterState() && groupings[m.grouping].key != nil {
+		cmds = append(cmds, m.list.SetItems(m.items()))
+	}
+	m.syncTable()
+	if m.restoreInstance != "" && len(m.list.VisibleItems()) > 0 {
+		m.selectInstance(m.restoreInstance)
+		m.restoreInstance = ""
+	}
 	return m, tea.Batch(cmds...)
 }
 
+func (m *Model) SaveState(s *state.UI) {
+	s.InstanceFilter = m.list.FilterValue()
+	if m.restoreFilter != "" {
+		s.InstanceFilter = m.restoreFilter
+	}
+	s.Instance = m.restoreInstance
+	if inst := m.highlighted(); inst != nil {
+		s.Instance = inst.Name
+	}
+}
+
+// applyFilter filters the list as if text was typed in the filter, the list
+// having no way to set it directly.
+func (m *Model) applyFilter(text string) tea.Cmd {
+	// The filter is typed in through its binding, which may have been unbound.
+	if len(views.Keys.Filter.Keys()) == 0 {
+		return nil
+	}
+	var cmds []tea.Cmd
+	for _, msg := range []tea.Msg{
+		views.KeyPress(views.Keys.Filter.Keys()[0]),
+		tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(text)},
+		tea.KeyMsg{Type: tea.KeyEnter},
+	} {
+		var cmd tea.Cmd
+		m.list, cmd = m.list.Update(msg)
+		cmds = append(cmds, cmd)
+	}
+	return tea.Batch(cmds...)
+}
+
+// selectInstance moves the cursor to the visible instance named name.
+func (m *Model) selectInstance(name string) {
+	for i, item := range m.list.VisibleItems() {
+		if inst, ok := item.(*gcloud.Instance); ok && inst.Name == name {
+			m.list.Select(i)
+			if m.tableMode {
+				m.table.selectItem(inst)
+			}
+			return
+		}
+	}
+}
+
+// items lists the running instances, under a header per group when grouped.
+func (m *Model) items() []list.Item {
+	g := groupings[m.grouping]
+	if g.key == nil {
+		items := make([]list.Item, len(m.running))
+		for i, inst := range m.running {
+			items[i] = inst
+		}
+		return items
+	}
+
+	all := map[string][]*gcloud.Instance{}
+	for _, inst := range m.instances {
+		all[g.key(inst)] = append(all[g.key(inst)], inst)
+	}
+	running := map[string][]*gcloud.Instance{}
+	for _, inst := range m.running {
+		running[g.key(inst)] = append(running[g.key(inst)], inst)
+	}
+	keys := make([]string, 0, len(all))
+	for k := range all {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	expandAll := m.list.FilterState() != list.Unfiltered
+	items := make([]list.Item, 0, len(keys)+len(m.running))
+	for _, k := range keys {
+		header := &groupItem{
+			key:       k,
+			count:     len(running[k]),
+			summary:   statusSummary(all[k]),
+			collapsed: m.collapsed[k] && !expandAll,
+		}
+		items = append(items, header)
+		if header.collapsed {
+			continue
+		}
+		for _, inst := range running[k] {
+			items = append(items, inst)
+		}
+	}
+	return items
+}
+
+// toggleGroup collapses or expands the group of the selected row, and keeps
+// the selection on its header.
+func (m *Model) toggleGroup() tea.Cmd {
+	g := groupings[m.grouping]
+	if g.key == nil {
+		return nil
+	}
+	selected := m.list.SelectedItem()
+	if m.tableMode {
+		selected = m.table.selectedItem()
+	}
+
+	var groupKey string
+	switch item := selected.(type) {
+	case *groupItem:
+		groupKey = item.key
+	case *gcloud.Instance:
+		groupKey = g.key(item)
+	default:
+		return nil
+	}
+	m.collapsed[groupKey] = !m.collapsed[groupKey]
+
+	cmd := m.list.SetItems(m.items())
+	for i, item := range m.list.Items() {
+		if header, ok := item.(*groupItem); ok && header.key == groupKey {
+			m.list.Select(i)
+		}
+	}
+	m.syncTable()
+	m.table.selectGroup(groupKey)
+	return cmd
+}
+
+// highlighted returns the instance under the cursor, in either layout.
+func (m *Model) highlighted() *gcloud.Instance {
+	item := m.list.SelectedItem()
+	if m.tableMode {
+		item = m.table.selectedItem()
+	}
+	inst, _ := item.(*gcloud.Instance)
+	return inst
+}
+
+// syncTable mirrors the visible, possibly filtered, list items in the table.
+func (m *Model) syncTable() {
+	if !m.tableMode {
+		return
+	}
+	m.table.setItems(m.list.VisibleItems())
+}
+
+func (m *Model) target() string {
+	if m.project != "" {
+		return fmt.Sprintf("%v/%v", m.configName, m.project)
+	}
+	return m.configName
+}
+
 func (m *Model) View() string {
 	style := views.PanelStyle.Width(m.size.Width - 2).Height(m.size.Height - 2)
-	selectedStyle := style.BorderForeground(lipgloss.Color("#5f5fd7"))
+	selectedStyle := style.BorderForeground(views.Colors.Border)
 
-	configStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#ee6ff8"))
+	configStyle := lipgloss.NewStyle().Foreground(views.Colors.Highlight)
+	if m.protected {
+		configStyle = configStyle.Foreground(views.Colors.Warning)
+	}
 
 	filterStr := ""
 	if m.list.FilterValue() != "" {
 		filterStr = lipgloss.NewStyle().
-			Background(lipgloss.Color("#baa000")).
-			Foreground(lipgloss.Color("#ffffff")).
+			Background(views.Colors.Warning).
+			Foreground(views.Colors.WarningText).
 			Render(fmt.Sprintf(" 🔍 \"%v\" ", m.list.FilterValue()))
 	}
 
+	groupStr := ""
+	if name := groupings[m.grouping].name; name != "" {
+		groupStr = lipgloss.NewStyle().Foreground(views.Colors.Muted).Render(" by " + name)
+	}
+
 	titleStyle := lipgloss.NewStyle()
 
 	if m.focused {
 		style = selectedStyle
-		titleStyle = titleStyle.Background(lipgloss.Color("62"))
-		configStyle = configStyle.Background(lipgloss.Color("62"))
+		titleStyle = titleStyle.Background(views.Colors.Accent)
+		configStyle = configStyle.Background(views.Colors.Accent)
 	} else {
 		titleStyle = titleStyle.Background(lipgloss.NoColor{})
 		configStyle = configStyle.Background(lipgloss.NoColor{})
@@ -170,33 +544,50 @@ func (m *Model) View() string {
 
 	m.list.Title = lipgloss.JoinHorizontal(0,
 		lipgloss.JoinHorizontal(0,
-			titleStyle.Foreground(lipgloss.Color("#ffffff")).Render(" Select a GCP instance in "),
-			configStyle.Render(fmt.Sprintf("[%v]", m.configName)),
+			titleStyle.Foreground(views.Colors.AccentText).Render(" Select a GCP instance in "),
+			configStyle.Render(fmt.Sprintf("[%v]", m.target())),
 			titleStyle.Render(" "),
 		),
+		groupStr,
 		" ",
 		filterStr,
 	)
 
+	if m.authExpired {
+		return style.Align(lipgloss.Center, lipgloss.Center).Foreground(views.Colors.Error).Render(
+			fmt.Sprintf("🔒 Authentication expired for [%v]\n\nPress %v to run gcloud auth login\nor %v for application-default login",
+				m.target(), views.Keys.Login.Help().Key, views.Keys.LoginADC.Help().Key),
+		)
+	}
+
 	if m.error != nil {
-		return style.Align(lipgloss.Center, lipgloss.Center).Foreground(lipgloss.Color("202")).Render(
-			fmt.Sprintf("Error fetching instances for [%v]\n%v", m.configName, m.error.Error()),
+		return style.Align(lipgloss.Center, lipgloss.Center).Foreground(views.Colors.Error).Render(
+			fmt.Sprintf("Error fetching instances for [%v]\n%v", m.target(), m.error.Error()),
 		)
 	}
 
 	if m.loading {
-		return style.Align(lipgloss.Center, lipgloss.Center).Render(fmt.Sprintf("Fetching instances for %s...", lipgloss.NewStyle().Foreground(lipgloss.Color("#7275ff")).Render(m.configName)))
+		return style.Align(lipgloss.Center, lipgloss.Center).Render(fmt.Sprintf("Fetching instances for %s...", lipgloss.NewStyle().Foreground(views.Colors.Info).Render(m.target())))
+	}
+
+	body := m.list.View()
+	if m.tableMode {
+		header := m.list.Styles.TitleBar.Render(m.list.Styles.Title.Render(m.list.Title))
+		if m.list.FilterState() == list.Filtering {
+			header = m.list.Styles.TitleBar.Render(m.list.FilterInput.View())
+		}
+		body = lipgloss.JoinVertical(0, header, m.table.view())
 	}
 
 	return style.Render(
 		lipgloss.JoinVertical(0,
-			m.list.View(),
+			body,
 			"",
-			lipgloss.NewStyle().Width(m.size.Width-5).AlignHorizontal(lipgloss.Right).Foreground(lipgloss.Color("#aaaaaa")).
+			lipgloss.NewStyle().Width(m.size.Width-5).AlignHorizontal(lipgloss.Right).Foreground(views.Colors.Muted).
 				Render(
 					lipgloss.JoinHorizontal(0,
-						lipgloss.NewStyle().Foreground(lipgloss.Color("62")).Render("Last update: "),
-						lipgloss.NewStyle().Foreground(lipgloss.Color("#888888")).Render(m.lastUpdate.Format("02/01/2006 15:04:05")),
+						lipgloss.NewStyle().Foreground(views.Colors.Accent).Render("Last update: "),
+						lipgloss.NewStyle().Foreground(views.Colors.Muted).Render(m.lastUpdate.Format("02/01/2006 15:04:05")),
 					),
 				),
 		),
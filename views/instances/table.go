@@ -0,0 +1,339 @@
+package instances
+
+import (
+	"fmt"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"gssh/config"
+	"gssh/gcloud"
+	"gssh/views"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+type column struct {
+	name  string
+	title string
+	width int
+	value func(i *gcloud.Instance) string
+	// less orders by something else than value, e.g. age by timestamp.
+	less func(a, b *gcloud.Instance) bool
+}
+
+var columns = []column{
+	{name: "name", title: "Name", value: func(i *gcloud.Instance) string { return i.Name }},
+	{name: "zone", title: "Zone", width: 16, value: func(i *gcloud.Instance) string { return path.Base(i.Zone) }},
+	{name: "status", title: "Status", width: 11, value: func(i *gcloud.Instance) string { return string(i.Status) }},
+	{name: "machine_type", title: "Machine type", width: 16, value: func(i *gcloud.Instance) string { return i.MachineType }},
+	{name: "internal_ip", title: "Internal IP", width: 15, value: func(i *gcloud.Instance) string { return i.InternalIP }},
+	{name: "external_ip", title: "External IP", width: 15, value: func(i *gcloud.Instance) string { return i.ExternalIP }},
+	{name: "labels", title: "Labels", width: 30, value: formatLabels},
+	{
+		name:  "age",
+		title: "Age",
+		width: 6,
+		value: func(i *gcloud.Instance) string { return formatAge(i.CreatedAt) },
+		less:  func(a, b *gcloud.Instance) bool { return a.CreatedAt.After(b.CreatedAt) },
+	},
+}
+
+var tableColumns []column
+var defaultSort string
+
+func init() {
+	names := config.Config.Instances.Columns
+	if len(names) == 0 {
+		names = []string{"name", "zone", "status", "machine_type", "internal_ip", "external_ip", "age"}
+	}
+	for _, name := range names {
+		c, ok := findColumn(name)
+		if !ok {
+			log.Fatal("Error in [instances] config: unknown column ", name)
+		}
+		tableColumns = append(tableColumns, c)
+	}
+
+	defaultSort = config.Config.Instances.SortBy
+	if _, ok := findColumn(strings.TrimPrefix(defaultSort, "-")); !ok {
+		defaultSort = "name"
+	}
+}
+
+func findColumn(name string) (column, bool) {
+	for _, c := range columns {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return column{}, false
+}
+
+func formatLabels(i *gcloud.Instance) string {
+	labels := make([]string, 0, len(i.Labels))
+	for k, v := range i.Labels {
+		labels = append(labels, k+"="+v)
+	}
+	sort.Strings(labels)
+	return strings.Join(labels, ",")
+}
+
+func formatAge(createdAt time.Time) string {
+	if createdAt.IsZero() {
+		return ""
+	}
+	age := time.Since(createdAt)
+	switch {
+	case age >= 24*time.Hour:
+		return fmt.Sprintf("%dd", int(age.Hours()/24))
+	case age >= time.Hour:
+		return fmt.Sprintf("%dh", int(age.Hours()))
+	default:
+		return fmt.Sprintf("%dm", int(age.Minutes()))
+	}
+}
+
+// instanceTable is the alternate, sortable table layout of the instances
+// panel. Its rows follow the items of the list, so that the list filter
+// applies to both layouts. The table model keeps the rows and the cursor,
+// while the rows are rendered here, from offset, to know which is where.
+type instanceTable struct {
+	table      table.Model
+	styles     table.Styles
+	rows       []list.Item
+	columns    []table.Column
+	sortColumn int
+	descending bool
+	width      int
+	offset     int
+}
+
+func newInstanceTable() *instanceTable {
+	t := table.New(table.WithFocused(true))
+	styles := table.DefaultStyles()
+	styles.Header = styles.Header.
+		BorderStyle(lipgloss.NormalBorder()).
+		BorderForeground(views.Colors.Muted).
+		BorderBottom(true).
+		Bold(true)
+	styles.Selected = styles.Selected.
+		Foreground(views.Colors.AccentText).
+		Background(views.Colors.Accent)
+	t.SetStyles(styles)
+
+	it := &instanceTable{table: t, styles: styles}
+	for i, c := range tableColumns {
+		if c.name == strings.TrimPrefix(defaultSort, "-") {
+			it.sortColumn = i
+			it.descending = strings.HasPrefix(defaultSort, "-")
+		}
+	}
+	return it
+}
+
+func (t *instanceTable) setSize(width int, height int) {
+	t.width = width
+	t.table.SetWidth(width)
+	t.table.SetHeight(height)
+	t.layoutColumns()
+}
+
+func (t *instanceTable) layoutColumns() {
+	fixed := 0
+	flexible := 0
+	for _, c := range tableColumns {
+		if c.width == 0 {
+			flexible++
+		}
+		// Cells are padded by one space on each side.
+		fixed += c.width + 2
+	}
+	flexWidth := 20
+	if flexible > 0 {
+		flexWidth = max((t.width-fixed)/flexible, 10)
+	}
+
+	cols := make([]table.Column, len(tableColumns))
+	for i, c := range tableColumns {
+		title := c.title
+		if i == t.sortColumn {
+			if t.descending {
+				title += " ▼"
+			} else {
+				title += " ▲"
+			}
+		}
+		w := c.width
+		if w == 0 {
+			w = flexWidth
+		}
+		cols[i] = table.Column{Title: title, Width: w}
+	}
+	t.columns = cols
+	t.table.SetColumns(cols)
+}
+
+// setItems shows the instances, sorted within each group, below their group
+// header rows.
+func (t *instanceTable) setItems(items []list.Item) {
+	selected := t.selectedItem()
+
+	var rows []list.Item
+	var segment []*gcloud.Instance
+	flush := func() {
+		t.sort(segment)
+		for _, inst := range segment {
+			rows = append(rows, inst)
+		}
+		segment = nil
+	}
+	for _, item := range items {
+		switch item := item.(type) {
+		case *groupItem:
+			flush()
+			rows = append(rows, item)
+		case *gcloud.Instance:
+			segment = append(segment, item)
+		}
+	}
+	flush()
+	t.rows = rows
+
+	tableRows := make([]table.Row, len(rows))
+	cursor := 0
+	for i, item := range rows {
+		row := make(table.Row, len(tableColumns))
+		switch item := item.(type) {
+		case *groupItem:
+			row[0] = item.Title()
+			if len(row) > 1 {
+				row[1] = item.summary
+			}
+		case *gcloud.Instance:
+			for j, c := range tableColumns {
+				row[j] = c.value(item)
+			}
+		}
+		tableRows[i] = row
+		if sameItem(item, selected) {
+			cursor = i
+		}
+	}
+	t.table.SetRows(tableRows)
+	t.table.SetCursor(cursor)
+}
+
+func (t *instanceTable) sort(instances []*gcloud.Instance) {
+	sortColumn := tableColumns[t.sortColumn]
+	sort.SliceStable(instances, func(a, b int) bool {
+		ia, ib := instances[a], instances[b]
+		if t.descending {
+			ia, ib = ib, ia
+		}
+		if sortColumn.less != nil {
+			return sortColumn.less(ia, ib)
+		}
+		return sortColumn.value(ia) < sortColumn.value(ib)
+	})
+}
+
+func sameItem(a, b list.Item) bool {
+	switch a := a.(type) {
+	case *groupItem:
+		b, ok := b.(*groupItem)
+		return ok && a.key == b.key
+	case *gcloud.Instance:
+		b, ok := b.(*gcloud.Instance)
+		return ok && a.Name == b.Name && a.Zone == b.Zone
+	}
+	return false
+}
+
+func (t *instanceTable) cycleSort() {
+	t.sortColumn = (t.sortColumn + 1) % len(tableColumns)
+	t.descending = false
+	t.layoutColumns()
+}
+
+func (t *instanceTable) reverseSort() {
+	t.descending = !t.descending
+	t.layoutColumns()
+}
+
+func (t *instanceTable) selectedItem() list.Item {
+	cursor := t.table.Cursor()
+	if cursor < 0 || cursor >= len(t.rows) {
+		return nil
+	}
+	return t.rows[cursor]
+}
+
+// scroll moves the offset as little as needed to show the cursor.
+func (t *instanceTable) scroll() {
+	height := max(t.table.Height(), 1)
+	cursor := t.table.Cursor()
+	t.offset = min(t.offset, cursor)
+	if cursor >= t.offset+height {
+		t.offset = cursor - height + 1
+	}
+	t.offset = max(min(t.offset, len(t.rows)-height), 0)
+}
+
+// rowAt returns the row rendered at line y of the table, header included,
+// or -1.
+func (t *instanceTable) rowAt(y int) int {
+	t.scroll()
+	// The header and its border come first.
+	line := y - 2
+	if line < 0 || line >= t.table.Height() || t.offset+line >= len(t.rows) {
+		return -1
+	}
+	return t.offset + line
+}
+
+func (t *instanceTable) cell(value string, width int) string {
+	return lipgloss.NewStyle().Width(width).MaxWidth(width).Inline(true).Render(ansi.Truncate(value, width, "…"))
+}
+
+func (t *instanceTable) view() string {
+	t.scroll()
+	headers := make([]string, len(t.columns))
+	for i, c := range t.columns {
+		headers[i] = t.styles.Header.Render(t.cell(c.Title, c.Width))
+	}
+	lines := []string{lipgloss.JoinHorizontal(lipgloss.Left, headers...)}
+
+	rows := t.table.Rows()
+	for i := t.offset; i < min(t.offset+t.table.Height(), len(rows)); i++ {
+		cells := make([]string, len(t.columns))
+		for j, c := range t.columns {
+			cells[j] = t.styles.Cell.Render(t.cell(rows[i][j], c.Width))
+		}
+		row := lipgloss.JoinHorizontal(lipgloss.Left, cells...)
+		if i == t.table.Cursor() {
+			row = t.styles.Selected.Render(row)
+		}
+		lines = append(lines, row)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (t *instanceTable) selectItem(item list.Item) {
+	for i, row := range t.rows {
+		if sameItem(row, item) {
+			t.table.SetCursor(i)
+		}
+	}
+}
+
+func (t *instanceTable) selectGroup(key string) {
+	for i, item := range t.rows {
+		if header, ok := item.(*groupItem); ok && header.key == key {
+			t.table.SetCursor(i)
+		}
+	}
+}
@@ -0,0 +1,394 @@
+package views
+
+import (
+	"fmt"
+	"github.com/charmbracelet/bubbles/key"
+	"gssh/config"
+	"log"
+	"sort"
+	"strings"
+)
+
+type KeyMap struct {
+	Quit         key.Binding
+	NextPanel    key.Binding
+	PrevPanel    key.Binding
+	Select       key.Binding
+	Filter       key.Binding
+	Reload       key.Binding
+	ClearHistory key.Binding
+	SpeedDial    key.Binding
+	Login        key.Binding
+	LoginADC     key.Binding
+	Help         key.Binding
+	Palette      key.Binding
+	Maximize     key.Binding
+	Copy         key.Binding
+	OpenConsole  key.Binding
+	SerialPort   key.Binding
+	SerialOutput key.Binding
+	Play         key.Binding
+
+	ToggleTable key.Binding
+	GroupBy     key.Binding
+	SortTable   key.Binding
+	ReverseSort key.Binding
+
+	Expand              key.Binding
+	Impersonate         key.Binding
+	NewConfiguration    key.Binding
+	CloneConfiguration  key.Binding
+	RenameConfiguration key.Binding
+	DeleteConfiguration key.Binding
+
+	Follow     key.Binding
+	NextMatch  key.Binding
+	PrevMatch  key.Binding
+	SaveOutput key.Binding
+
+	SpeedUp   key.Binding
+	SlowDown  key.Binding
+	SkipToEnd key.Binding
+}
+
+// NamedBinding ties a binding to its name in the [keys] section of
+// config.toml.
+type NamedBinding struct {
+	Name    string
+	Binding *key.Binding
+}
+
+// Keys is the keymap shared by every view.
+var Keys KeyMap
+
+func init() {
+	keys, err := NewKeyMap(config.Config.Keys)
+	if err != nil {
+		log.Fatal("Error in [keys] config: ", err)
+	}
+	Keys = keys
+}
+
+func binding(desc string, keys ...string) key.Binding {
+	return key.NewBinding(key.WithKeys(keys...), key.WithHelp(helpKey(keys), desc))
+}
+
+func DefaultKeyMap() KeyMap {
+	return KeyMap{
+		Quit:         binding("Quit", "q", "ctrl+c"),
+		NextPanel:    binding("Next panel", "tab", "right"),
+		PrevPanel:    binding("Previous panel", "shift+tab", "left"),
+		Select:       binding("Select", "enter"),
+		Filter:       binding("Filter instances", "/"),
+		Reload:       binding("Reload instances", "r"),
+		ClearHistory: binding("Clear history", "c"),
+		SpeedDial:    binding("Speed dial history", "0", "1", "2", "3", "4", "5", "6", "7", "8", "9"),
+		Login:        binding("Log in", "l"),
+		LoginADC:     binding("Application-default log in", "L"),
+		Help:         binding("Help", "?"),
+		Palette:      binding("Command palette", "ctrl+p"),
+		Maximize:     binding("Maximize panel", "z"),
+		Copy:         binding("Copy", "Y"),
+		OpenConsole:  binding("Open in Cloud Console", "o"),
+		SerialPort:   binding("Serial console", "x"),
+		SerialOutput: binding("Serial port output", "v"),
+		Play:         binding("Play recording", "p"),
+
+		ToggleTable: binding("Table view", "t"),
+		GroupBy:     binding("Group by", "g"),
+		SortTable:   binding("Sort column", "s"),
+		ReverseSort: binding("Reverse sort", "S"),
+
+		Expand:              binding("Expand/collapse", " "),
+		Impersonate:         binding("Impersonate", "i"),
+		NewConfiguration:    binding("New", "n"),
+		CloneConfiguration:  binding("Clone", "y"),
+		RenameConfiguration: binding("Rename", "e"),
+		DeleteConfiguration: binding("Delete", "d"),
+
+		Follow:     binding("Follow output", "f"),
+		NextMatch:  binding("Next match", "]"),
+		PrevMatch:  binding("Previous match", "["),
+		SaveOutput: binding("Save to file", "w"),
+
+		SpeedUp:   binding("Faster", "+"),
+		SlowDown:  binding("Slower", "-"),
+		SkipToEnd: binding("Skip to end", "G"),
+	}
+}
+
+func (k *KeyMap) Named() []NamedBinding {
+	return []NamedBinding{
+		{"quit", &k.Quit},
+		{"next_panel", &k.NextPanel},
+		{"prev_panel", &k.PrevPanel},
+		{"select", &k.Select},
+		{"filter", &k.Filter},
+		{"reload", &k.Reload},
+		{"clear_history", &k.ClearHistory},
+		{"speed_dial", &k.SpeedDial},
+		{"login", &k.Login},
+		{"login_application_default", &k.LoginADC},
+		{"help", &k.Help},
+		{"palette", &k.Palette},
+		{"maximize", &k.Maximize},
+		{"copy", &k.Copy},
+		{"open_console", &k.OpenConsole},
+		{"serial_port", &k.SerialPort},
+		{"serial_output", &k.SerialOutput},
+		{"play", &k.Play},
+		{"toggle_table", &k.ToggleTable},
+		{"group_by", &k.GroupBy},
+		{"sort_table", &k.SortTable},
+		{"reverse_sort", &k.ReverseSort},
+		{"expand", &k.Expand},
+		{"impersonate", &k.Impersonate},
+		{"new_configuration", &k.NewConfiguration},
+		{"clone_configuration", &k.CloneConfiguration},
+		{"rename_configuration", &k.RenameConfiguration},
+		{"delete_configuration", &k.DeleteConfiguration},
+		{"follow", &k.Follow},
+		{"next_match", &k.NextMatch},
+		{"prev_match", &k.PrevMatch},
+		{"save_output", &k.SaveOutput},
+		{"speed_up", &k.SpeedUp},
+		{"slow_down", &k.SlowDown},
+		{"skip_to_end", &k.SkipToEnd},
+	}
+}
+
+// NewKeyMap applies the overrides from config.toml on top of the default
+// keymap and rejects keys bound to more than one action.
+func NewKeyMap(overrides map[string][]string) (KeyMap, error) {
+	k := DefaultKeyMap()
+	named := k.Named()
+
+	known := map[string]bool{}
+	for _, nb := range named {
+		known[nb.Name] = true
+		keys, ok := overrides[nb.Name]
+		if !ok {
+			continue
+		}
+		if len(keys) == 0 {
+			nb.Binding.Unbind()
+			continue
+		}
+		nb.Binding.SetKeys(keys...)
+		nb.Binding.SetHelp(helpKey(keys), nb.Binding.Help().Desc)
+	}
+
+	var unknown []string
+	for name := range overrides {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return k, fmt.Errorf("unknown key bindings: %v", strings.Join(unknown, ", "))
+	}
+
+	owners := map[string]string{}
+	for _, nb := range named {
+		for _, key := range nb.Binding.Keys() {
+			if owner, ok := owners[key]; ok {
+				return k, fmt.Errorf("%q is bound to both %v and %v", key, owner, nb.Name)
+			}
+			owners[key] = nb.Name
+		}
+	}
+	return k, nil
+}
+
+// KeyGroup lists the bindings relevant to one panel. Short holds the few
+// shown in the status bar, Full everything shown in the help overlay.
+type KeyGroup struct {
+	Title string
+	Short []key.Binding
+	Full  []key.Binding
+}
+
+// withDesc returns a copy of b described as desc, for actions whose meaning
+// depends on the panel.
+func withDesc(b key.Binding, desc string) key.Binding {
+	b.SetHelp(b.Help().Key, desc)
+	return b
+}
+
+func browse(desc string) key.Binding {
+	return key.NewBinding(key.WithKeys("up", "down"), key.WithHelp("↑↓", desc))
+}
+
+func (k *KeyMap) PanelGroup(panel ActivePanel) KeyGroup {
+	switch panel {
+	case Configurations:
+		return KeyGroup{
+			Title: "Configurations",
+			Short: []key.Binding{withDesc(k.Select, "Activate"), withDesc(k.Expand, "Projects"), k.NewConfiguration},
+			Full: []key.Binding{
+				browse("Browse configurations"),
+				withDesc(k.Select, "Activate configuration"),
+				withDesc(k.Expand, "Show projects"),
+				k.Impersonate,
+				withDesc(k.NewConfiguration, "New configuration"),
+				withDesc(k.CloneConfiguration, "Clone configuration"),
+				withDesc(k.RenameConfiguration, "Rename configuration"),
+				withDesc(k.DeleteConfiguration, "Delete configuration"),
+			},
+		}
+	case Instances:
+		return KeyGroup{
+			Title: "Instances",
+			Short: []key.Binding{withDesc(k.Select, "SSH"), k.Filter, k.ToggleTable, k.Reload},
+			Full: []key.Binding{
+				browse("Browse instances"),
+				withDesc(k.Select, "SSH to instance"),
+				withDesc(k.Copy, "Copy name, IP, command or URL"),
+				k.OpenConsole,
+				k.SerialPort,
+				k.SerialOutput,
+				k.Filter,
+				k.Reload,
+				k.ToggleTable,
+				k.GroupBy,
+				withDesc(k.Expand, "Collapse group"),
+				k.SortTable,
+				k.ReverseSort,
+				k.Login,
+				k.LoginADC,
+			},
+		}
+	case History:
+		return KeyGroup{
+			Title: "History",
+			Short: []key.Binding{withDesc(k.Select, "SSH"), k.SpeedDial, k.ClearHistory},
+			Full: []key.Binding{
+				browse("Browse history"),
+				withDesc(k.Select, "SSH to instance"),
+				k.SpeedDial,
+				withDesc(k.Copy, "Copy name, IP, command or URL"),
+				k.OpenConsole,
+				k.SerialPort,
+				k.SerialOutput,
+				k.Play,
+				k.ClearHistory,
+			},
+		}
+	}
+	return KeyGroup{}
+}
+
+func (k *KeyMap) SerialOutputGroup() KeyGroup {
+	return KeyGroup{
+		Title: "Serial port output",
+		Short: []key.Binding{withDesc(k.Filter, "Search"), k.Follow, k.SaveOutput, closeKey},
+		Full: []key.Binding{
+			browse("Scroll"),
+			withDesc(k.Filter, "Search"),
+			k.NextMatch,
+			k.PrevMatch,
+			k.Follow,
+			k.SaveOutput,
+			closeKey,
+		},
+	}
+}
+
+func (k *KeyMap) PlayerGroup() KeyGroup {
+	return KeyGroup{
+		Title: "Recording player",
+		Short: []key.Binding{withDesc(k.Expand, "Play/pause"), k.SpeedUp, k.SlowDown, closeKey},
+		Full: []key.Binding{
+			browse("Scroll"),
+			withDesc(k.Expand, "Play/pause"),
+			k.SpeedUp,
+			k.SlowDown,
+			withDesc(k.Reload, "Restart"),
+			k.SkipToEnd,
+			closeKey,
+		},
+	}
+}
+
+// DialogGroup lists the keys of the dialog of a failed connection, with the
+// options form when options is set.
+func (k *KeyMap) DialogGroup(options bool) KeyGroup {
+	retry := withDesc(k.Reload, "Retry")
+	dismiss := withDesc(closeKey, "Dismiss")
+	if !options {
+		return KeyGroup{
+			Title: "Failed connection",
+			Short: []key.Binding{retry, dismiss},
+			Full:  []key.Binding{retry, dismiss},
+		}
+	}
+	different := withDesc(k.OpenConsole, "Connect with different options")
+	return KeyGroup{
+		Title: "Failed connection",
+		Short: []key.Binding{retry, different, dismiss},
+		Full:  []key.Binding{retry, withDesc(k.Select, "Retry"), different, dismiss},
+	}
+}
+
+var closeKey = key.NewBinding(key.WithKeys("esc"), key.WithHelp(keySymbol("esc"), "Close"))
+
+func (k *KeyMap) GlobalGroup() KeyGroup {
+	return KeyGroup{
+		Title: "Global",
+		Short: []key.Binding{k.Help, k.Quit},
+		Full: []key.Binding{
+			k.NextPanel,
+			k.PrevPanel,
+			k.Filter,
+			k.Reload,
+			k.ClearHistory,
+			k.SpeedDial,
+			k.Login,
+			k.Palette,
+			k.Maximize,
+			k.Help,
+			k.Quit,
+		},
+	}
+}
+
+// SpeedDialIndex returns the history index dialed by key, or -1.
+func (k *KeyMap) SpeedDialIndex(key string) int {
+	for i, dial := range k.SpeedDial.Keys() {
+		if dial == key {
+			return i
+		}
+	}
+	return -1
+}
+
+var keySymbols = map[string]string{
+	"enter":     "↵",
+	"tab":       "⇥",
+	"shift+tab": "⇤",
+	"up":        "↑",
+	"down":      "↓",
+	"left":      "←",
+	"right":     "→",
+	" ":         "␣",
+	"esc":       "⎋",
+}
+
+func keySymbol(k string) string {
+	if s, ok := keySymbols[k]; ok {
+		return s
+	}
+	return k
+}
+
+// helpKey renders the keys of a binding for the status bar.
+func helpKey(keys []string) string {
+	if len(keys) == 0 {
+		return ""
+	}
+	if len(keys) > 2 {
+		return keySymbol(keys[0]) + "-" + keySymbol(keys[len(keys)-1])
+	}
+	return keySymbol(keys[0])
+}
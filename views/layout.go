@@ -1,8 +1,13 @@
 package views
 
 import (
+	"fmt"
 	"github.com/charmbracelet/lipgloss"
 	bl "github.com/winder/bubblelayout"
+	"gssh/config"
+	"log"
+	"sort"
+	"strings"
 )
 
 type ActivePanel int
@@ -13,6 +18,76 @@ const (
 	History
 )
 
+// LayoutCell is a panel of a layout, with its bubblelayout constraints.
+type LayoutCell struct {
+	Panel       ActivePanel
+	Constraints string
+}
+
+// Layout lists the rows of panels, top to bottom. The status bar is docked
+// below every layout.
+type Layout [][]LayoutCell
+
+var Layouts = map[string]Layout{
+	"default": {
+		{{Configurations, ""}, {Instances, "wrap"}},
+		{{History, "spanw 2 wrap"}},
+	},
+	"history-right": {
+		{{Configurations, "width 30:40:40, growy"}, {Instances, "grow"}, {History, "width 30:40:40, growy, wrap"}},
+	},
+	"no-configurations": {
+		{{Instances, "grow, wrap"}},
+		{{History, "height 10:12:14, wrap"}},
+	},
+	"compact": {
+		{{Instances, "grow, wrap"}},
+	},
+}
+
+// PanelLayout is the layout selected in config.toml.
+var PanelLayout Layout
+
+func init() {
+	layout, err := NewLayout(config.Config.Layout.Preset)
+	if err != nil {
+		log.Fatal("Error in [layout] config: ", err)
+	}
+	PanelLayout = layout
+}
+
+func NewLayout(preset string) (Layout, error) {
+	if preset == "" {
+		preset = "default"
+	}
+	layout, ok := Layouts[preset]
+	if !ok {
+		var names []string
+		for n := range Layouts {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown preset %q, expected one of %v", preset, strings.Join(names, ", "))
+	}
+	return layout, nil
+}
+
+// Maximized is the layout of panel alone.
+func Maximized(panel ActivePanel) Layout {
+	return Layout{{{panel, "grow, wrap"}}}
+}
+
+func (l Layout) Contains(panel ActivePanel) bool {
+	for _, row := range l {
+		for _, cell := range row {
+			if cell.Panel == panel {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 var PanelStyle = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(1)
 
 func BoxStyle(size bl.Size, border bool) lipgloss.Style {
@@ -0,0 +1,51 @@
+package views
+
+import (
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"strings"
+)
+
+// ClickMsg is a left click in a panel, at X, Y relative to its top left
+// corner.
+type ClickMsg struct {
+	X, Y   int
+	Double bool
+}
+
+// WheelMsg scrolls the panel under the mouse by one item.
+type WheelMsg struct {
+	Down bool
+}
+
+// ListItemAt returns the index, among the visible items, of the item of l
+// rendered at line y of a panel, or -1.
+func ListItemAt(l list.Model, y int) int {
+	d := NewListDelegate()
+	top := PanelStyle.GetBorderTopSize() + PanelStyle.GetPaddingTop() + l.Styles.TitleBar.GetVerticalFrameSize() + 1
+	row := y - top
+	if row < 0 || row%(d.Height()+d.Spacing()) >= d.Height() {
+		return -1
+	}
+	line := row / (d.Height() + d.Spacing())
+	index := l.Paginator.Page*l.Paginator.PerPage + line
+	if line >= l.Paginator.PerPage || index >= len(l.VisibleItems()) {
+		return -1
+	}
+	return index
+}
+
+// KeyPress returns the message of pressing k, a key as named in key
+// bindings.
+func KeyPress(k string) tea.KeyMsg {
+	alt := false
+	if rest, ok := strings.CutPrefix(k, "alt+"); ok && rest != "" {
+		alt, k = true, rest
+	}
+	for t := tea.KeyType(-100); t <= tea.KeyBackspace; t++ {
+		if t != tea.KeyRunes && (tea.Key{Type: t}).String() == k {
+			return tea.KeyMsg{Type: t, Alt: alt}
+		}
+	}
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k), Alt: alt}
+}
@@ -0,0 +1,186 @@
+package palette
+
+import (
+	"github.com/charmbracelet/bubbles/cursor"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sahilm/fuzzy"
+	"gssh/views"
+	"strings"
+)
+
+var _ tea.Model = &Model{}
+
+// Command is an action offered by the palette. Running it dispatches Msg, the
+// same message the panels use for the action.
+type Command struct {
+	Title string
+	Hint  string
+	Msg   tea.Msg
+}
+
+// Provider is implemented by the panels offering commands of their own, such
+// as connecting to one of their instances.
+type Provider interface {
+	Commands() []Command
+}
+
+type OpenMsg struct {
+	Commands []Command
+}
+type ClosedMsg struct{}
+
+type Model struct {
+	width    int
+	height   int
+	input    textinput.Model
+	commands []Command
+	matches  fuzzy.Matches
+	cursor   int
+}
+
+func InitialModel() *Model {
+	input := textinput.New()
+	input.Prompt = "> "
+	input.Placeholder = "Type a command..."
+	input.Cursor.SetMode(cursor.CursorStatic)
+	return &Model{
+		input: input,
+	}
+}
+
+func (m *Model) Init() tea.Cmd {
+	return nil
+}
+
+func (m *Model) titles() []string {
+	titles := make([]string, len(m.commands))
+	for i, c := range m.commands {
+		titles[i] = c.Title
+	}
+	return titles
+}
+
+func (m *Model) filter() {
+	pattern := strings.TrimSpace(m.input.Value())
+	if pattern == "" {
+		m.matches = make(fuzzy.Matches, len(m.commands))
+		for i, c := range m.commands {
+			m.matches[i] = fuzzy.Match{Str: c.Title, Index: i}
+		}
+	} else {
+		m.matches = fuzzy.Find(pattern, m.titles())
+	}
+	m.cursor = 0
+}
+
+func closed() tea.Msg {
+	return ClosedMsg{}
+}
+
+func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+
+	case OpenMsg:
+		m.commands = msg.Commands
+		m.input.SetValue("")
+		m.input.Focus()
+		m.filter()
+
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "esc", "ctrl+c":
+			return m, closed
+		case "enter":
+			if m.cursor >= len(m.matches) {
+				return m, closed
+			}
+			command := m.commands[m.matches[m.cursor].Index]
+			return m, tea.Batch(closed, func() tea.Msg {
+				return command.Msg
+			})
+		case "up", "ctrl+k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+			return m, nil
+		case "down", "ctrl+j":
+			if m.cursor < len(m.matches)-1 {
+				m.cursor++
+			}
+			return m, nil
+		}
+
+		var cmd tea.Cmd
+		previous := m.input.Value()
+		m.input, cmd = m.input.Update(msg)
+		if m.input.Value() != previous {
+			m.filter()
+		}
+		return m, cmd
+	}
+	return m, nil
+}
+
+func highlight(title string, indexes []int, style lipgloss.Style) string {
+	matched := map[int]bool{}
+	for _, i := range indexes {
+		matched[i] = true
+	}
+	var b strings.Builder
+	// The indexes are byte offsets.
+	for i, r := range title {
+		if matched[i] {
+			b.WriteString(style.Bold(true).Underline(true).Render(string(r)))
+		} else {
+			b.WriteString(style.Render(string(r)))
+		}
+	}
+	return b.String()
+}
+
+func (m *Model) View() string {
+	width := min(m.width-4, 80)
+	visible := max(m.height-10, 1)
+
+	start := 0
+	if m.cursor >= visible {
+		start = m.cursor - visible + 1
+	}
+	end := min(start+visible, len(m.matches))
+
+	lines := []string{m.input.View(), ""}
+	for i := start; i < end; i++ {
+		match := m.matches[i]
+		command := m.commands[match.Index]
+
+		style := lipgloss.NewStyle()
+		hintStyle := lipgloss.NewStyle().Foreground(views.Colors.Muted)
+		prefix := "  "
+		if i == m.cursor {
+			style = style.Foreground(views.Colors.Highlight)
+			hintStyle = hintStyle.Foreground(views.Colors.HighlightDetail)
+			prefix = "▸ "
+		}
+
+		title := highlight(command.Title, match.MatchedIndexes, style)
+		hint := hintStyle.Render(command.Hint)
+		gap := max(width-lipgloss.Width(prefix+command.Title)-lipgloss.Width(hint)-4, 1)
+		lines = append(lines, style.Render(prefix)+title+strings.Repeat(" ", gap)+hint)
+	}
+	if len(m.matches) == 0 {
+		lines = append(lines, lipgloss.NewStyle().Foreground(views.Colors.Muted).Render("  No matching command"))
+	}
+
+	// Anchored to the top so that the box does not jump around while the
+	// matches are being narrowed down.
+	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Top,
+		views.PanelStyle.BorderForeground(views.Colors.Border).Width(width).MarginTop(2).Render(
+			lipgloss.JoinVertical(lipgloss.Left, lines...),
+		),
+	)
+}
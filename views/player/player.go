@@ -0,0 +1,317 @@
+package player
+
+import (
+	"fmt"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"gssh/recording"
+	"gssh/views"
+	"strings"
+	"time"
+)
+
+var _ tea.Model = &Model{}
+
+// OpenMsg opens the player on a session recording.
+type OpenMsg struct {
+	File  string
+	Title string
+}
+type ClosedMsg struct{}
+
+type loadedMsg struct {
+	open   int
+	header *recording.Header
+	events []recording.Event
+	err    error
+}
+type tickMsg struct {
+	play int
+}
+
+const (
+	tickInterval = 50 * time.Millisecond
+	// maxIdle caps the pauses of the recording, as asciinema's
+	// idle_time_limit.
+	maxIdle  = 2 * time.Second
+	maxSpeed = 16
+)
+
+// Model is the full-screen player of the recording of an SSH session.
+type Model struct {
+	width  int
+	height int
+
+	target   OpenMsg
+	viewport viewport.Model
+	header   *recording.Header
+	events   []recording.Event
+	screen   *screen
+	loading  bool
+	err      error
+
+	// played events have been written to the screen, up to position in the
+	// recording.
+	played   int
+	position time.Duration
+	playing  bool
+	speed    float64
+
+	// open and play number the openings of the player and the playback
+	// loops, so that stale messages are dropped.
+	open int
+	play int
+}
+
+func InitialModel() *Model {
+	vp := viewport.New(0, 0)
+	vp.KeyMap = viewport.KeyMap{
+		PageDown:     key.NewBinding(key.WithKeys("pgdown")),
+		PageUp:       key.NewBinding(key.WithKeys("pgup")),
+		HalfPageUp:   key.NewBinding(key.WithKeys("ctrl+u")),
+		HalfPageDown: key.NewBinding(key.WithKeys("ctrl+d")),
+		Up:           key.NewBinding(key.WithKeys("up")),
+		Down:         key.NewBinding(key.WithKeys("down")),
+	}
+	return &Model{
+		viewport: vp,
+		screen:   newScreen(0, 0),
+		speed:    1,
+	}
+}
+
+func (m *Model) Init() tea.Cmd {
+	return nil
+}
+
+func (m *Model) load() tea.Cmd {
+	file, open := m.target.File, m.open
+	return func() tea.Msg {
+		header, events, err := recording.Load(file)
+		// Long pauses are shortened, so that playback gets to the point.
+		var shift time.Duration
+		var last time.Duration
+		for i := range events {
+			at := events[i].Time
+			if gap := at - last; gap > maxIdle {
+				shift += gap - maxIdle
+			}
+			last = at
+			events[i].Time = at - shift
+		}
+		return loadedMsg{open: open, header: header, events: events, err: err}
+	}
+}
+
+func (m *Model) tick() tea.Cmd {
+	play := m.play
+	return tea.Tick(tickInterval, func(time.Time) tea.Msg {
+		return tickMsg{play}
+	})
+}
+
+func (m *Model) setSize() {
+	frame, _ := views.PanelStyle.GetFrameSize()
+	m.viewport.Width = max(m.width-frame, 0)
+	// The title and the footer take two lines each.
+	m.viewport.Height = max(m.height-frame-4, 0)
+	m.render()
+}
+
+// newScreen is sized as the recorded terminal, once the recording is loaded.
+func (m *Model) newScreen() *screen {
+	if m.header == nil {
+		return newScreen(0, 0)
+	}
+	return newScreen(m.header.Width, m.header.Height)
+}
+
+func (m *Model) restart() tea.Cmd {
+	m.screen = m.newScreen()
+	m.played = 0
+	m.position = 0
+	m.render()
+	return m.start()
+}
+
+func (m *Model) start() tea.Cmd {
+	m.play++
+	m.playing = true
+	return m.tick()
+}
+
+// advance writes the events up to the playback position.
+func (m *Model) advance() {
+	for m.played < len(m.events) && m.events[m.played].Time <= m.position {
+		m.screen.write(m.events[m.played].Data)
+		m.played++
+	}
+	if m.played == len(m.events) {
+		m.playing = false
+		m.play++
+	}
+	m.render()
+	m.viewport.GotoBottom()
+}
+
+func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		m.setSize()
+
+	case OpenMsg:
+		m.open++
+		m.play++
+		m.target = msg
+		m.events = nil
+		m.loading = true
+		m.playing = false
+		m.err = nil
+		m.speed = 1
+		m.header = nil
+		m.screen = m.newScreen()
+		m.played = 0
+		m.position = 0
+		m.render()
+		return m, m.load()
+
+	case loadedMsg:
+		if msg.open != m.open {
+			return m, nil
+		}
+		m.loading = false
+		m.err = msg.err
+		m.header = msg.header
+		m.events = msg.events
+		m.screen = m.newScreen()
+		if msg.err == nil {
+			return m, m.start()
+		}
+
+	case tickMsg:
+		if msg.play != m.play || !m.playing {
+			return m, nil
+		}
+		m.position += time.Duration(float64(tickInterval) * m.speed)
+		m.advance()
+		if m.playing {
+			return m, m.tick()
+		}
+
+	case tea.MouseMsg:
+		var cmd tea.Cmd
+		m.viewport, cmd = m.viewport.Update(msg)
+		return m, cmd
+
+	case tea.KeyMsg:
+		return m, m.handleKey(msg)
+	}
+	return m, nil
+}
+
+func (m *Model) handleKey(msg tea.KeyMsg) tea.Cmd {
+	keys := views.Keys
+	switch {
+	case msg.String() == "esc":
+		m.open++
+		m.play++
+		m.playing = false
+		return func() tea.Msg {
+			return ClosedMsg{}
+		}
+	case m.loading || m.err != nil:
+	case key.Matches(msg, keys.Expand):
+		if m.playing {
+			m.playing = false
+			m.play++
+			return nil
+		}
+		if m.played == len(m.events) {
+			return m.restart()
+		}
+		return m.start()
+	case key.Matches(msg, keys.SpeedUp):
+		m.speed = min(m.speed*2, maxSpeed)
+	case key.Matches(msg, keys.SlowDown):
+		m.speed = max(m.speed/2, 1.0/maxSpeed)
+	case key.Matches(msg, keys.Reload):
+		return m.restart()
+	case key.Matches(msg, keys.SkipToEnd):
+		if len(m.events) > 0 {
+			m.position = m.events[len(m.events)-1].Time
+			m.advance()
+		}
+	default:
+		var cmd tea.Cmd
+		m.viewport, cmd = m.viewport.Update(msg)
+		return cmd
+	}
+	return nil
+}
+
+func (m *Model) render() {
+	// Long lines are cut rather than wrapped, to keep one line per row.
+	lines := m.screen.text()
+	for i, line := range lines {
+		lines[i] = ansi.Truncate(line, m.viewport.Width, "…")
+	}
+	m.viewport.SetContent(strings.Join(lines, "\n"))
+}
+
+func formatPosition(d time.Duration) string {
+	d = d.Round(time.Second)
+	return fmt.Sprintf("%d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
+
+func (m *Model) View() string {
+	if m.target.File == "" {
+		return ""
+	}
+
+	var status string
+	switch {
+	case m.loading:
+		status = "Loading..."
+	case len(m.events) > 0:
+		end := m.events[len(m.events)-1].Time
+		status = fmt.Sprintf("%v / %v", formatPosition(min(m.position, end)), formatPosition(end))
+		if m.playing {
+			status += fmt.Sprintf(", playing at %gx", m.speed)
+		} else if m.played < len(m.events) {
+			status += ", paused"
+		}
+	}
+	title := lipgloss.JoinHorizontal(0,
+		lipgloss.NewStyle().Background(views.Colors.Accent).Foreground(views.Colors.AccentText).Render(" Recording of "),
+		lipgloss.NewStyle().Background(views.Colors.Accent).Foreground(views.Colors.Highlight).Render(m.target.Title+" "),
+		lipgloss.NewStyle().Foreground(views.Colors.Muted).Render(" "+status),
+	)
+
+	var footer string
+	if m.err != nil {
+		footer = lipgloss.NewStyle().Foreground(views.Colors.Error).Render(m.err.Error())
+	} else {
+		var hints []string
+		for _, b := range views.Keys.PlayerGroup().Short {
+			if b.Enabled() {
+				hints = append(hints, b.Help().Key+" "+b.Help().Desc)
+			}
+		}
+		footer = lipgloss.NewStyle().Foreground(views.Colors.Muted).Render(strings.Join(hints, " • "))
+	}
+
+	return views.PanelStyle.BorderForeground(views.Colors.Border).
+		Width(max(m.width-2, 0)).Height(max(m.height-2, 0)).
+		Render(lipgloss.JoinVertical(lipgloss.Left,
+			title,
+			"",
+			m.viewport.View(),
+			"",
+			lipgloss.NewStyle().MaxWidth(m.viewport.Width).Render(footer),
+		))
+}
@@ -0,0 +1,180 @@
+package player
+
+import (
+	"strconv"
+	"strings"
+)
+
+type parseState int
+
+const (
+	stateText parseState = iota
+	stateEscape
+	stateCharset
+	stateCSI
+	stateOSC
+	stateOSCEscape
+)
+
+// screen turns terminal output into lines of text. It follows the carriage
+// returns, backspaces, cursor moves and erases a shell uses to edit its
+// command line, and drops colours. Full-screen programs are not emulated.
+type screen struct {
+	lines  [][]rune
+	row    int
+	col    int
+	state  parseState
+	params string
+	// width and height are those of the recorded terminal. Lines wrap at
+	// width, and cursor moves stay within both.
+	width  int
+	height int
+}
+
+const (
+	defaultWidth  = 80
+	defaultHeight = 24
+)
+
+func newScreen(width int, height int) *screen {
+	if width <= 0 {
+		width = defaultWidth
+	}
+	if height <= 0 {
+		height = defaultHeight
+	}
+	return &screen{lines: [][]rune{nil}, width: width, height: height}
+}
+
+func (s *screen) write(data string) {
+	for _, r := range data {
+		switch s.state {
+		case stateEscape:
+			switch r {
+			case '[':
+				s.state, s.params = stateCSI, ""
+			case ']':
+				s.state = stateOSC
+			case '(', ')', '*', '+':
+				s.state = stateCharset
+			default:
+				s.state = stateText
+			}
+		case stateCharset:
+			s.state = stateText
+		case stateCSI:
+			if r >= 0x40 && r <= 0x7e {
+				s.csi(r)
+				s.state = stateText
+			} else {
+				s.params += string(r)
+			}
+		case stateOSC:
+			// Window titles end with BEL or ESC \.
+			switch r {
+			case '\a':
+				s.state = stateText
+			case '\x1b':
+				s.state = stateOSCEscape
+			}
+		case stateOSCEscape:
+			s.state = stateText
+		default:
+			s.put(r)
+		}
+	}
+}
+
+func (s *screen) put(r rune) {
+	switch r {
+	case '\x1b':
+		s.state = stateEscape
+	case '\r':
+		s.col = 0
+	case '\n':
+		s.moveRow(1)
+	case '\b':
+		s.col = max(s.col-1, 0)
+	case '\t':
+		s.col = min((s.col/8+1)*8, s.width-1)
+	default:
+		if r < ' ' || r == 0x7f {
+			return
+		}
+		if s.col >= s.width {
+			s.col = 0
+			s.moveRow(1)
+		}
+		line := s.lines[s.row]
+		for len(line) <= s.col {
+			line = append(line, ' ')
+		}
+		line[s.col] = r
+		s.lines[s.row] = line
+		s.col++
+	}
+}
+
+func (s *screen) moveRow(delta int) {
+	s.row = max(s.row+delta, 0)
+	for len(s.lines) <= s.row {
+		s.lines = append(s.lines, nil)
+	}
+}
+
+// csi applies the control sequence ending with final.
+func (s *screen) csi(final rune) {
+	n, err := strconv.Atoi(strings.TrimPrefix(s.params, "?"))
+	if err != nil || n <= 0 {
+		n = 1
+	}
+	n = min(n, s.width)
+	line := s.lines[s.row]
+	switch final {
+	case 'A':
+		s.moveRow(-n)
+	case 'B':
+		s.moveRow(min(n, s.height))
+	case 'C':
+		s.col = min(s.col+n, s.width-1)
+	case 'D':
+		s.col = max(s.col-n, 0)
+	case 'G':
+		s.col = n - 1
+	case 'K':
+		switch s.params {
+		case "", "0":
+			if s.col < len(line) {
+				s.lines[s.row] = line[:s.col]
+			}
+		case "1":
+			for i := 0; i <= s.col && i < len(line); i++ {
+				line[i] = ' '
+			}
+		case "2":
+			s.lines[s.row] = nil
+		}
+	case 'P':
+		// Deletes characters at the cursor, shifting the rest left.
+		if s.col < len(line) {
+			s.lines[s.row] = append(line[:s.col], line[min(s.col+n, len(line)):]...)
+		}
+	case '@':
+		// Inserts blanks at the cursor, shifting the rest right.
+		if s.col < len(line) {
+			inserted := make([]rune, 0, len(line)+n)
+			inserted = append(inserted, line[:s.col]...)
+			inserted = append(inserted, []rune(strings.Repeat(" ", n))...)
+			inserted = append(inserted, line[s.col:]...)
+			s.lines[s.row] = inserted[:min(len(inserted), s.width)]
+		}
+	}
+}
+
+func (s *screen) text() []string {
+	lines := make([]string, len(s.lines))
+	for i, line := range s.lines {
+		lines[i] = strings.TrimRight(string(line), " ")
+	}
+	return lines
+}
@@ -0,0 +1,359 @@
+package serial
+
+import (
+	"fmt"
+	"github.com/charmbracelet/bubbles/cursor"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"gssh/gcloud"
+	"gssh/views"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var _ tea.Model = &Model{}
+
+// OpenMsg opens the viewer on the serial port output of an instance.
+type OpenMsg struct {
+	Instance       *gcloud.Instance
+	ConfigName     string
+	ServiceAccount string
+}
+type ClosedMsg struct{}
+
+type outputMsg struct {
+	open     int
+	start    int64
+	contents string
+	next     int64
+	err      error
+}
+type pollMsg struct {
+	poll int
+}
+type savedMsg struct {
+	path string
+	err  error
+}
+
+const pollInterval = 2 * time.Second
+
+// Model is the full-screen viewer of the serial port output of an instance.
+// In follow mode it polls for the output written since the last fetch.
+type Model struct {
+	width  int
+	height int
+
+	target   OpenMsg
+	viewport viewport.Model
+	lines    []string
+	next     int64
+	loading  bool
+	err      error
+	notice   string
+	follow   bool
+
+	// open and poll number the openings of the viewer and the follow loops,
+	// so that the results of stale fetches are dropped.
+	open int
+	poll int
+
+	search    textinput.Model
+	searching bool
+	matches   []int
+	match     int
+}
+
+func InitialModel() *Model {
+	vp := viewport.New(0, 0)
+	vp.KeyMap = viewport.KeyMap{
+		PageDown:     key.NewBinding(key.WithKeys("pgdown")),
+		PageUp:       key.NewBinding(key.WithKeys("pgup")),
+		HalfPageUp:   key.NewBinding(key.WithKeys("ctrl+u")),
+		HalfPageDown: key.NewBinding(key.WithKeys("ctrl+d")),
+		Up:           key.NewBinding(key.WithKeys("up")),
+		Down:         key.NewBinding(key.WithKeys("down")),
+	}
+
+	search := textinput.New()
+	search.Prompt = "🔍 "
+	search.Placeholder = "Search..."
+	search.Cursor.SetMode(cursor.CursorStatic)
+
+	return &Model{
+		viewport: vp,
+		search:   search,
+	}
+}
+
+func (m *Model) Init() tea.Cmd {
+	return nil
+}
+
+func (m *Model) fetch() tea.Cmd {
+	target, open, start := m.target, m.open, m.next
+	return func() tea.Msg {
+		contents, next, err := target.Instance.SerialPortOutput(target.ConfigName, target.ServiceAccount, start)
+		// Follow mode polls are part of the fetch of the whole output.
+		if start == 0 {
+			_ = gcloud.Audit(target.Instance.AuditEntry("serial_port.output", target.ConfigName, target.ServiceAccount, nil), err)
+		}
+		return outputMsg{open: open, start: start, contents: contents, next: next, err: err}
+	}
+}
+
+func (m *Model) schedulePoll() tea.Cmd {
+	poll := m.poll
+	return tea.Tick(pollInterval, func(time.Time) tea.Msg {
+		return pollMsg{poll}
+	})
+}
+
+func (m *Model) setSize() {
+	frame, _ := views.PanelStyle.GetFrameSize()
+	m.viewport.Width = max(m.width-frame, 0)
+	// The title and the footer take two lines each.
+	m.viewport.Height = max(m.height-frame-4, 0)
+	m.render()
+}
+
+func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		m.setSize()
+
+	case OpenMsg:
+		m.open++
+		m.poll++
+		m.target = msg
+		m.lines = nil
+		m.next = 0
+		m.loading = true
+		m.err = nil
+		m.notice = ""
+		m.follow = false
+		m.searching = false
+		m.matches = nil
+		m.search.SetValue("")
+		m.render()
+		return m, m.fetch()
+
+	case outputMsg:
+		if msg.open != m.open || msg.start != m.next {
+			return m, nil
+		}
+		m.loading = false
+		m.err = msg.err
+		if msg.err == nil {
+			m.append(msg.contents)
+			m.next = msg.next
+		}
+		if m.follow {
+			m.viewport.GotoBottom()
+			return m, m.schedulePoll()
+		}
+
+	case pollMsg:
+		if msg.poll == m.poll && m.follow {
+			return m, m.fetch()
+		}
+
+	case savedMsg:
+		if msg.err != nil {
+			m.notice = "Error saving output: " + msg.err.Error()
+		} else {
+			m.notice = "Saved to " + msg.path
+		}
+
+	case tea.MouseMsg:
+		var cmd tea.Cmd
+		m.viewport, cmd = m.viewport.Update(msg)
+		return m, cmd
+
+	case tea.KeyMsg:
+		return m, m.handleKey(msg)
+	}
+	return m, nil
+}
+
+func (m *Model) handleKey(msg tea.KeyMsg) tea.Cmd {
+	keys := views.Keys
+	if m.searching {
+		switch msg.String() {
+		case "esc":
+			m.searching = false
+			m.search.Blur()
+		case "enter":
+			m.searching = false
+			m.search.Blur()
+			m.match = 0
+			m.findMatches()
+			m.jump(0)
+		default:
+			var cmd tea.Cmd
+			m.search, cmd = m.search.Update(msg)
+			return cmd
+		}
+		return nil
+	}
+
+	switch {
+	case msg.String() == "esc":
+		m.open++
+		m.poll++
+		return func() tea.Msg {
+			return ClosedMsg{}
+		}
+	case key.Matches(msg, keys.Filter):
+		m.searching = true
+		return m.search.Focus()
+	case key.Matches(msg, keys.NextMatch):
+		m.jump(1)
+	case key.Matches(msg, keys.PrevMatch):
+		m.jump(-1)
+	case key.Matches(msg, keys.Follow):
+		m.follow = !m.follow
+		m.poll++
+		if m.follow {
+			m.viewport.GotoBottom()
+			return m.fetch()
+		}
+	case key.Matches(msg, keys.SaveOutput):
+		return m.save()
+	default:
+		var cmd tea.Cmd
+		m.viewport, cmd = m.viewport.Update(msg)
+		return cmd
+	}
+	return nil
+}
+
+// append adds output to the log. The output may stop and resume in the
+// middle of a line.
+func (m *Model) append(contents string) {
+	if contents == "" {
+		return
+	}
+	// Boot logs are full of colours and cursor movements.
+	contents = ansi.Strip(strings.ReplaceAll(contents, "\r\n", "\n"))
+	contents = strings.NewReplacer("\r", "", "\t", "    ").Replace(contents)
+	added := strings.Split(contents, "\n")
+	if len(m.lines) > 0 {
+		m.lines[len(m.lines)-1] += added[0]
+		added = added[1:]
+	}
+	m.lines = append(m.lines, added...)
+	m.findMatches()
+}
+
+func (m *Model) findMatches() {
+	m.matches = nil
+	term := strings.ToLower(m.search.Value())
+	if term != "" {
+		for i, line := range m.lines {
+			if strings.Contains(strings.ToLower(line), term) {
+				m.matches = append(m.matches, i)
+			}
+		}
+	}
+	m.match = min(m.match, max(len(m.matches)-1, 0))
+	m.render()
+}
+
+// jump moves to the next or previous match, wrapping around.
+func (m *Model) jump(delta int) {
+	if len(m.matches) == 0 {
+		return
+	}
+	m.match = (m.match + delta + len(m.matches)) % len(m.matches)
+	m.render()
+	m.viewport.SetYOffset(m.matches[m.match] - m.viewport.Height/2)
+}
+
+func (m *Model) render() {
+	matchStyle := lipgloss.NewStyle().Background(views.Colors.Warning).Foreground(views.Colors.WarningText)
+	currentStyle := lipgloss.NewStyle().Background(views.Colors.Accent).Foreground(views.Colors.AccentText)
+
+	// Long lines are cut rather than wrapped, to keep one line per row.
+	lines := make([]string, len(m.lines))
+	for i, line := range m.lines {
+		lines[i] = ansi.Truncate(line, m.viewport.Width, "…")
+	}
+	for i, line := range m.matches {
+		style := matchStyle
+		if i == m.match {
+			style = currentStyle
+		}
+		lines[line] = style.Render(lines[line])
+	}
+	m.viewport.SetContent(strings.Join(lines, "\n"))
+}
+
+func (m *Model) save() tea.Cmd {
+	target := m.target
+	name := fmt.Sprintf("%v-serial-%v.log", target.Instance.Name, time.Now().Format("20060102-150405"))
+	contents := strings.Join(m.lines, "\n")
+	return func() tea.Msg {
+		err := os.WriteFile(name, []byte(contents), 0644)
+		file, _ := filepath.Abs(name)
+		_ = gcloud.Audit(target.Instance.AuditEntry("serial_port.save", target.ConfigName, target.ServiceAccount, map[string]string{"file": file}), err)
+		return savedMsg{path: name, err: err}
+	}
+}
+
+func (m *Model) View() string {
+	if m.target.Instance == nil {
+		return ""
+	}
+
+	status := fmt.Sprintf("%d bytes", m.next)
+	if m.loading {
+		status = "Fetching..."
+	} else if m.follow {
+		status += ", following"
+	}
+	title := lipgloss.JoinHorizontal(0,
+		lipgloss.NewStyle().Background(views.Colors.Accent).Foreground(views.Colors.AccentText).Render(" Serial port output of "),
+		lipgloss.NewStyle().Background(views.Colors.Accent).Foreground(views.Colors.Highlight).Render(fmt.Sprintf("[%v] %v ", m.target.ConfigName, m.target.Instance.Name)),
+		lipgloss.NewStyle().Foreground(views.Colors.Muted).Render(" "+status),
+	)
+
+	var footer string
+	switch {
+	case m.searching:
+		footer = m.search.View()
+	case m.err != nil:
+		footer = lipgloss.NewStyle().Foreground(views.Colors.Error).Render(m.err.Error())
+	case m.notice != "":
+		footer = lipgloss.NewStyle().Foreground(views.Colors.Info).Render(m.notice)
+	default:
+		var hints []string
+		if m.search.Value() != "" {
+			hints = append(hints, fmt.Sprintf("%d matches", len(m.matches)))
+		}
+		for _, b := range views.Keys.SerialOutputGroup().Short {
+			if b.Enabled() {
+				hints = append(hints, b.Help().Key+" "+b.Help().Desc)
+			}
+		}
+		footer = lipgloss.NewStyle().Foreground(views.Colors.Muted).Render(strings.Join(hints, " • "))
+	}
+
+	return views.PanelStyle.BorderForeground(views.Colors.Border).
+		Width(max(m.width-2, 0)).Height(max(m.height-2, 0)).
+		Render(lipgloss.JoinVertical(lipgloss.Left,
+			title,
+			"",
+			m.viewport.View(),
+			"",
+			lipgloss.NewStyle().MaxWidth(m.viewport.Width).Render(footer),
+		))
+}
@@ -1,23 +1,42 @@
 package statusbar
 
 import (
+	"github.com/charmbracelet/bubbles/key"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	bl "github.com/winder/bubblelayout"
 	"gssh/views"
 	"math"
+	"time"
 )
 
 var _ tea.Model = &Model{}
-var baseStyle = lipgloss.NewStyle().Background(lipgloss.Color("62"))
+var baseStyle = lipgloss.NewStyle().Background(views.Colors.Accent)
 
 type SetActivePanelMsg struct {
 	ActivePanel views.ActivePanel
 }
 
+type SetIdentityMsg struct {
+	Identity string
+}
+
+// NoticeMsg briefly shows Text in place of the panel title.
+type NoticeMsg struct {
+	Text string
+}
+type clearNoticeMsg struct {
+	seq int
+}
+
+const noticeDuration = 3 * time.Second
+
 type Model struct {
 	size        bl.Size
 	activePanel views.ActivePanel
+	identity    string
+	notice      string
+	noticeSeq   int
 }
 
 func InitialModel() *Model {
@@ -36,6 +55,27 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.size = msg
 	case SetActivePanelMsg:
 		m.activePanel = msg.ActivePanel
+	case SetIdentityMsg:
+		m.identity = msg.Identity
+	case NoticeMsg:
+		m.notice = msg.Text
+		m.noticeSeq++
+		seq := m.noticeSeq
+		return m, tea.Tick(noticeDuration, func(time.Time) tea.Msg {
+			return clearNoticeMsg{seq}
+		})
+	case clearNoticeMsg:
+		// A newer notice stays up for its own duration.
+		if msg.seq == m.noticeSeq {
+			m.notice = ""
+		}
+	case views.ClickMsg:
+		// Clicking a shortcut presses its key.
+		if b, ok := m.shortcutAt(msg.X); ok {
+			return m, func() tea.Msg {
+				return views.KeyPress(b.Keys()[0])
+			}
+		}
 	}
 
 	return m, nil
@@ -44,56 +84,77 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 func shortcut(key string, action string) string {
 	return lipgloss.JoinHorizontal(
 		lipgloss.Center,
-		baseStyle.Background(lipgloss.Color("5")).Foreground(lipgloss.Color("62")).Render("▌"+key+"▐"),
-		baseStyle.Foreground(lipgloss.Color("#bbbbbb")).Render(action),
+		baseStyle.Background(views.Colors.StatusKey).Foreground(views.Colors.Accent).Render("▌"+key+"▐"),
+		baseStyle.Foreground(views.Colors.Subtle).Render(action),
 		baseStyle.Render(" "),
 	)
 }
 
-func (m *Model) View() string {
-	var activeView string
-
-	var enter string
-	var arrows string
-	switch m.activePanel {
-	case views.Configurations:
-		activeView = "Configurations"
-		enter = "Activate configuration"
-		arrows = "Browse configurations"
-	case views.Instances:
-		activeView = "Instances"
-		enter = "SSH to instance"
-		arrows = "Browse instances"
-	case views.History:
-		activeView = "History"
-		enter = "SSH to instance"
-		arrows = "Browse history"
-	default:
-		enter = ""
+func bindingShortcut(b key.Binding) string {
+	if !b.Enabled() {
+		return ""
 	}
+	return shortcut(b.Help().Key, b.Help().Desc)
+}
 
-	shortcuts := baseStyle.Padding(0, 1).Align(lipgloss.Right, lipgloss.Center).Render(
-		lipgloss.JoinHorizontal(
-			0,
-			shortcut("↑↓", arrows),
-			shortcut("⇥", "Next panel"),
-			shortcut("/", "Filter instances"),
-			shortcut("↵", enter),
-			shortcut("R", "Reload instances"),
-			shortcut("C", "Clear history"),
-			shortcut("0-9", "Speed dial history"),
-			shortcut("Q", "Quit"),
-		),
+func renderShortcuts(bindings []key.Binding) string {
+	items := make([]string, 0, len(bindings))
+	for _, b := range bindings {
+		items = append(items, bindingShortcut(b))
+	}
+	return baseStyle.Padding(0, 1).Align(lipgloss.Right, lipgloss.Center).Render(
+		lipgloss.JoinHorizontal(0, items...),
 	)
+}
+
+// shortcuts returns the keys that fit, dropping the least relevant panel keys
+// first. The help overlay lists everything.
+func (m *Model) shortcuts() []key.Binding {
+	panel := views.Keys.PanelGroup(m.activePanel)
+	global := views.Keys.GlobalGroup()
+
+	n := len(panel.Short)
+	bindings := append(panel.Short[:n:n], global.Short...)
+	for n > 0 && lipgloss.Width(renderShortcuts(bindings)) > m.size.Width-len(panel.Title)-4 {
+		n--
+		bindings = append(panel.Short[:n:n], global.Short...)
+	}
+	return bindings
+}
+
+// shortcutAt returns the shortcut rendered at column x. Shortcuts are aligned
+// to the right edge of the bar.
+func (m *Model) shortcutAt(x int) (key.Binding, bool) {
+	end := m.size.Width
+	bindings := m.shortcuts()
+	for i := len(bindings) - 1; i >= 0; i-- {
+		start := end - lipgloss.Width(bindingShortcut(bindings[i]))
+		if x >= start && x < end {
+			return bindings[i], bindings[i].Enabled()
+		}
+		end = start
+	}
+	return key.Binding{}, false
+}
+
+func (m *Model) View() string {
+	activeView := views.Keys.PanelGroup(m.activePanel).Title
+	shortcuts := renderShortcuts(m.shortcuts())
 
 	activeViewStr := "[" + activeView + "]"
+	if m.identity != "" {
+		activeViewStr += " as " + m.identity
+	}
+	if m.notice != "" {
+		activeViewStr = m.notice
+	}
 	truncate := int(math.Min(float64(len(activeViewStr)), math.Max(0, float64(m.size.Width-lipgloss.Width(shortcuts)-2))))
 	activeViewStr = activeViewStr[0:truncate]
 
 	return baseStyle.Width(m.size.Width).Padding(0, 1).Render(
 		lipgloss.JoinHorizontal(
 			0,
-			baseStyle.Width(m.size.Width-lipgloss.Width(shortcuts)).Padding(0, 1).Foreground(lipgloss.Color("4")).Render(activeViewStr),
+			baseStyle.Width(m.size.Width-lipgloss.Width(shortcuts)).Padding(0, 1).Foreground(views.Colors.StatusTitle).Render(activeViewStr),
 			shortcuts,
 		),
 	)
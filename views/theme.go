@@ -0,0 +1,172 @@
+package views
+
+import (
+	"fmt"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+	"gssh/config"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+type Theme struct {
+	Accent          lipgloss.TerminalColor
+	AccentText      lipgloss.TerminalColor
+	Border          lipgloss.TerminalColor
+	Highlight       lipgloss.TerminalColor
+	HighlightDetail lipgloss.TerminalColor
+	Info            lipgloss.TerminalColor
+	Muted           lipgloss.TerminalColor
+	Subtle          lipgloss.TerminalColor
+	Error           lipgloss.TerminalColor
+	ErrorDetail     lipgloss.TerminalColor
+	Warning         lipgloss.TerminalColor
+	WarningText     lipgloss.TerminalColor
+	StatusKey       lipgloss.TerminalColor
+	StatusTitle     lipgloss.TerminalColor
+}
+
+// Colors is the theme shared by every view.
+var Colors Theme
+
+var themes = map[string]Theme{
+	"dark": {
+		Accent:          lipgloss.Color("62"),
+		AccentText:      lipgloss.Color("#ffffff"),
+		Border:          lipgloss.Color("#5f5fd7"),
+		Highlight:       lipgloss.Color("#ee6ff8"),
+		HighlightDetail: lipgloss.Color("#ad58b4"),
+		Info:            lipgloss.Color("#7275ff"),
+		Muted:           lipgloss.Color("#888888"),
+		Subtle:          lipgloss.Color("#bbbbbb"),
+		Error:           lipgloss.Color("202"),
+		ErrorDetail:     lipgloss.Color("#ff666b"),
+		Warning:         lipgloss.Color("#baa000"),
+		WarningText:     lipgloss.Color("#ffffff"),
+		StatusKey:       lipgloss.Color("5"),
+		StatusTitle:     lipgloss.Color("4"),
+	},
+	"light": {
+		Accent:          lipgloss.Color("#5f5fd7"),
+		AccentText:      lipgloss.Color("#ffffff"),
+		Border:          lipgloss.Color("#3a3ab0"),
+		Highlight:       lipgloss.Color("#a3169f"),
+		HighlightDetail: lipgloss.Color("#c94ec6"),
+		Info:            lipgloss.Color("#3a3ab0"),
+		Muted:           lipgloss.Color("#5c5c5c"),
+		Subtle:          lipgloss.Color("#eeeeee"),
+		Error:           lipgloss.Color("#c30000"),
+		ErrorDetail:     lipgloss.Color("#9e1f1f"),
+		Warning:         lipgloss.Color("#8a6d00"),
+		WarningText:     lipgloss.Color("#ffffff"),
+		StatusKey:       lipgloss.Color("#d7d7ff"),
+		StatusTitle:     lipgloss.Color("#ffffff"),
+	},
+	"high-contrast": {
+		Accent:          lipgloss.Color("#000080"),
+		AccentText:      lipgloss.Color("#ffffff"),
+		Border:          lipgloss.Color("#ffff00"),
+		Highlight:       lipgloss.Color("#ffff00"),
+		HighlightDetail: lipgloss.Color("#ffff87"),
+		Info:            lipgloss.Color("#00ffff"),
+		Muted:           lipgloss.Color("#ffffff"),
+		Subtle:          lipgloss.Color("#ffffff"),
+		Error:           lipgloss.Color("#ff0000"),
+		ErrorDetail:     lipgloss.Color("#ff5f5f"),
+		Warning:         lipgloss.Color("#ffff00"),
+		WarningText:     lipgloss.Color("#000000"),
+		StatusKey:       lipgloss.Color("#ffff00"),
+		StatusTitle:     lipgloss.Color("#ffffff"),
+	},
+	"no-color": {
+		Accent:          lipgloss.NoColor{},
+		AccentText:      lipgloss.NoColor{},
+		Border:          lipgloss.NoColor{},
+		Highlight:       lipgloss.NoColor{},
+		HighlightDetail: lipgloss.NoColor{},
+		Info:            lipgloss.NoColor{},
+		Muted:           lipgloss.NoColor{},
+		Subtle:          lipgloss.NoColor{},
+		Error:           lipgloss.NoColor{},
+		ErrorDetail:     lipgloss.NoColor{},
+		Warning:         lipgloss.NoColor{},
+		WarningText:     lipgloss.NoColor{},
+		StatusKey:       lipgloss.NoColor{},
+		StatusTitle:     lipgloss.NoColor{},
+	},
+}
+
+func init() {
+	theme, err := NewTheme(config.Config.Theme)
+	if err != nil {
+		log.Fatal("Error in [theme] config: ", err)
+	}
+	Colors = theme
+}
+
+func (t *Theme) named() map[string]*lipgloss.TerminalColor {
+	return map[string]*lipgloss.TerminalColor{
+		"accent":           &t.Accent,
+		"accent_text":      &t.AccentText,
+		"border":           &t.Border,
+		"highlight":        &t.Highlight,
+		"highlight_detail": &t.HighlightDetail,
+		"info":             &t.Info,
+		"muted":            &t.Muted,
+		"subtle":           &t.Subtle,
+		"error":            &t.Error,
+		"error_detail":     &t.ErrorDetail,
+		"warning":          &t.Warning,
+		"warning_text":     &t.WarningText,
+		"status_key":       &t.StatusKey,
+		"status_title":     &t.StatusTitle,
+	}
+}
+
+// NewTheme resolves the built-in theme selected in config.toml and applies
+// the colour overrides on top of it. NO_COLOR always wins.
+func NewTheme(c config.ThemeConfig) (Theme, error) {
+	name := c.Name
+	if name == "" {
+		name = "dark"
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		name = "no-color"
+	}
+
+	theme, ok := themes[name]
+	if !ok {
+		var names []string
+		for n := range themes {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return theme, fmt.Errorf("unknown theme %q, expected one of %v", c.Name, strings.Join(names, ", "))
+	}
+
+	if name == "no-color" {
+		lipgloss.SetColorProfile(termenv.Ascii)
+		return theme, nil
+	}
+
+	named := theme.named()
+	for role, value := range c.Colors {
+		color, ok := named[role]
+		if !ok {
+			return theme, fmt.Errorf("unknown theme colour %q", role)
+		}
+		*color = lipgloss.Color(value)
+	}
+	return theme, nil
+}
+
+// NewListDelegate returns the default list delegate styled with the theme.
+func NewListDelegate() list.DefaultDelegate {
+	d := list.NewDefaultDelegate()
+	d.Styles.SelectedTitle = d.Styles.SelectedTitle.Foreground(Colors.Highlight).BorderForeground(Colors.Highlight)
+	d.Styles.SelectedDesc = d.Styles.SelectedDesc.Foreground(Colors.HighlightDetail).BorderForeground(Colors.Highlight)
+	return d
+}